@@ -0,0 +1,344 @@
+package ctxrouter
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/ti/ctxrouter/errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+//requestParam binds the path variables into the fields of a request struct, which is the only param of handler,
+//exp: func (ctx *BookContext) GetBook(req *GetBookRequest) with /v1/{book.shelf=shelves/*}/books/{book.id}
+type requestParam struct {
+	//typ the struct type of request
+	typ reflect.Type
+	//fields the fields of variables, indexed by field path
+	fields map[string]field
+	//types the parsers of param types registered to the router
+	types *paramTypes
+}
+
+//field a field of request struct resolved by a dotted field path
+type field struct {
+	//index the indexes of struct fields of each component of field path
+	index [][]int
+	//typ the type of field, the pointers are dereferenced
+	typ reflect.Type
+}
+
+//newRequestParam returns the requestParam of the param type, it is nil if the type is not a pointer to struct,
+//or the type is converted from a single value as a registered type or an encoding.TextUnmarshaler
+func newRequestParam(t reflect.Type, types *paramTypes) *requestParam {
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct || t.Implements(textUnmarshalerType) ||
+		types.lookup(t) != nil || types.lookup(t.Elem()) != nil {
+		return nil
+	}
+	return &requestParam{typ: t.Elem(), fields: make(map[string]field), types: types}
+}
+
+//resolve resolves the fields of path variables, and the fields of host variables if the request struct has them
+func (r *requestParam) resolve(h *Handler) error {
+	for _, v := range h.Pat.vars {
+		f, ok := resolveField(r.typ, v)
+		if !ok {
+			return fmt.Errorf("variable %s of %s has no field in %v", v, h.template, r.typ)
+		}
+		r.fields[v] = f
+	}
+	if h.host == "" {
+		return nil
+	}
+	pat, err := ParsePatternURL(hostPath(h.host))
+	if err != nil {
+		return err
+	}
+	for _, v := range pat.vars {
+		if f, ok := resolveField(r.typ, v); ok {
+			r.fields[v] = f
+		}
+	}
+	return nil
+}
+
+//resolveField resolves the dotted field path in the struct type.
+//Each component matches the path tag, query tag, json tag, protobuf name or json name of a field,
+//or the field name when the underscores are ignored and the letters are compared case-insensitively
+func resolveField(t reflect.Type, path string) (f field, ok bool) {
+	for _, name := range strings.Split(path, ".") {
+		if name == "" {
+			return f, false
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return f, false
+		}
+		sf, found := fieldByName(t, name)
+		if !found {
+			return f, false
+		}
+		f.index = append(f.index, sf.Index)
+		t = sf.Type
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	f.typ = t
+	return f, true
+}
+
+//fieldByName finds the exported field of struct type by the name of a field path component, see resolveField
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	var fallback *reflect.StructField
+	for _, sf := range reflect.VisibleFields(t) {
+		if sf.PkgPath != "" || sf.Anonymous || skipped(sf) {
+			continue
+		}
+		if tagName(sf.Tag.Get("path")) == name || tagName(sf.Tag.Get("query")) == name || tagName(sf.Tag.Get("json")) == name {
+			return sf, true
+		}
+		for _, opt := range strings.Split(sf.Tag.Get("protobuf"), ",") {
+			if opt == "name="+name || opt == "json="+name {
+				return sf, true
+			}
+		}
+		if fallback == nil && strings.EqualFold(sf.Name, strings.Replace(name, "_", "", -1)) {
+			sf := sf
+			fallback = &sf
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return reflect.StructField{}, false
+}
+
+//skipped reports if a field opts out of binding by a "-" path, query or json tag
+func skipped(sf reflect.StructField) bool {
+	return tagName(sf.Tag.Get("path")) == "-" || tagName(sf.Tag.Get("query")) == "-" || tagName(sf.Tag.Get("json")) == "-"
+}
+
+//tagName returns the name of a struct tag, exp: "name,omitempty" to "name"
+func tagName(tag string) string {
+	if idx := strings.IndexByte(tag, ','); idx >= 0 {
+		return tag[:idx]
+	}
+	return tag
+}
+
+//accepts checks if the values of variables can be converted to the types of their fields
+func (r *requestParam) accepts(ps *PathParams) bool {
+	for name, f := range r.fields {
+		if v, ok := ps.Get(name); ok && !convertible(v, f.typ, r.types) {
+			return false
+		}
+	}
+	return true
+}
+
+//bind binds the values of variables to the fields of the request struct v,
+//it returns an error if any value can not be converted to the type of its field
+func (r *requestParam) bind(v reflect.Value, ps *PathParams) error {
+	for name, f := range r.fields {
+		if value, ok := ps.Get(name); ok {
+			if err := f.set(v, value, r.types); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//decode decodes the query and the path variables of the request into the request struct v in order,
+//so that the path variables override the others, see bindQuery. The body is decoded before it, see Handler.decodeBody
+func (r *requestParam) decode(req *http.Request, v reflect.Value, ps *PathParams, strict bool) error {
+	if err := r.bindQuery(req, v, strict); err != nil {
+		return err
+	}
+	return r.bind(v, ps)
+}
+
+//bindQuery binds the query and the urlencoded form of the request to the fields of the request struct v,
+//exp: ?page_size=10&filter.state=ACTIVE&ids=1&ids=2. The keys are dotted field paths, see resolveField,
+//the repeated keys are appended to the slice fields. The keys of path variables are ignored,
+//and so are the keys without field unless strict. The errors are reported as the field violations of errors.BadRequest
+func (r *requestParam) bindQuery(req *http.Request, v reflect.Value, strict bool) error {
+	values := req.URL.Query()
+	if ct := req.Header.Get("Content-Type"); strings.HasPrefix(ct, "application/x-www-form-urlencoded") {
+		if err := req.ParseForm(); err != nil {
+			return errors.CodeError(errors.InvalidArgument).WithDescription(err.Error())
+		}
+		for key, vals := range req.PostForm {
+			values[key] = append(values[key], vals...)
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var violations []*errors.BadRequestFieldViolation
+	for _, key := range keys {
+		if _, ok := r.fields[key]; ok {
+			continue
+		}
+		f, ok := resolveField(r.typ, key)
+		if !ok {
+			if strict {
+				violations = append(violations, &errors.BadRequestFieldViolation{Field: key, Description: "unknown field"})
+			}
+			continue
+		}
+		if err := f.setValues(v, values[key], r.types); err != nil {
+			violations = append(violations, &errors.BadRequestFieldViolation{Field: key, Description: err.Error()})
+		}
+	}
+	if len(violations) > 0 {
+		return errors.CodeError(errors.InvalidArgument).WithDescription("invalid query").
+			WithDetails(&errors.BadRequest{FieldViolations: violations})
+	}
+	return nil
+}
+
+//isBodyType checks if the handler param of type t can be a body param, which is a pointer to struct without param parser
+func isBodyType(t reflect.Type, types *paramTypes) bool {
+	return newRequestParam(t, types) != nil
+}
+
+//resolveBody checks the body of route, and resolves its field in the body param or request struct, see WithBody
+func (h *Handler) resolveBody() error {
+	var t reflect.Type
+	if h.bodyT != nil {
+		t = h.bodyT.Elem()
+	} else if h.request != nil {
+		t = h.request.typ
+	}
+	if h.body == "" {
+		if t != nil || h.typed != nil {
+			h.body = "*"
+		}
+		return nil
+	}
+	if t == nil {
+		return fmt.Errorf("body %s of %s has no body param or request struct", h.body, h.template)
+	}
+	if h.body == "*" {
+		return nil
+	}
+	f, ok := resolveField(t, h.body)
+	if !ok {
+		return fmt.Errorf("body %s of %s has no field in %v", h.body, h.template, t)
+	}
+	h.bodyField = &f
+	return nil
+}
+
+//decodeBody decodes the request body by dec into the struct v, or into its field selected by WithBody
+func (h *Handler) decodeBody(dec func(interface{}) error, v reflect.Value) error {
+	if h.bodyField != nil {
+		v = h.bodyField.value(v)
+	}
+	return dec(v.Addr().Interface())
+}
+
+//bodyDecoder returns the DecodeBody of the context, the body is decoded by its Content-Type if the context has none
+func bodyDecoder(ctx ContextInterface, req *http.Request) func(interface{}) error {
+	if d, ok := ctx.(BodyDecoder); ok {
+		return d.DecodeBody
+	}
+	return func(v interface{}) error {
+		return decodeBody(req, v)
+	}
+}
+
+//decodeBody decodes the request body into v by the codec of its Content-Type, json by default.
+//The empty bodies and the forms, which are bound by bindQuery, are not decoded
+func decodeBody(req *http.Request, v interface{}) error {
+	if req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	var err error
+	switch {
+	case mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data":
+		return nil
+	case strings.HasSuffix(mediaType, "xml"):
+		if err = xml.NewDecoder(req.Body).Decode(v); err != nil && err != io.EOF {
+			return fmt.Errorf("xml decode error - %v", err)
+		}
+	case mediaType == "" || strings.HasSuffix(mediaType, "json"):
+		if err = json.NewDecoder(req.Body).Decode(v); err != nil && err != io.EOF {
+			return fmt.Errorf("json decode error - %v", err)
+		}
+	default:
+		return errors.CodeError(errors.InvalidArgument).WithDescription("unsupported content type " + mediaType)
+	}
+	return nil
+}
+
+//set converts the value to the type of field, and sets it to the field of the struct v
+func (f field) set(v reflect.Value, value string, types *paramTypes) error {
+	v = f.value(v)
+	pv, err := strConv(value, v.Type(), types)
+	if err != nil {
+		return err
+	}
+	v.Set(pv)
+	return nil
+}
+
+//setValues sets the values to the field of the struct v, each value is appended to a slice field,
+//a field of other types accepts only one value
+func (f field) setValues(v reflect.Value, values []string, types *paramTypes) error {
+	v = f.value(v)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 || types.lookup(v.Type()) != nil {
+		if len(values) > 1 {
+			return fmt.Errorf("too many values: %d", len(values))
+		}
+		pv, err := strConv(values[0], v.Type(), types)
+		if err != nil {
+			return err
+		}
+		v.Set(pv)
+		return nil
+	}
+	for _, value := range values {
+		pv, err := strConv(value, v.Type().Elem(), types)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, pv))
+	}
+	return nil
+}
+
+//value returns the field of the struct v, the nil pointers on the way are allocated
+func (f field) value(v reflect.Value) reflect.Value {
+	for _, index := range f.index {
+		for _, i := range index {
+			v = indirect(v).Field(i)
+		}
+	}
+	return indirect(v)
+}
+
+//indirect returns the value which v points to, the nil pointers are allocated
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,292 @@
+// Command ctxrouter-gen generates the typed invokers of the context handlers registered in a package,
+// so that the router calls them without reflection, see ctxrouter.RegisterInvoker.
+//
+//	//go:generate ctxrouter-gen
+//
+// It scans the go files of the package for the routes registered by Get, Post, Put, Patch, Delete,
+// Head, Options, All, Handle and Registry.Handler with method expressions, exp: (*Context).Hello, or funcs whose first
+// param is the context, and writes the invokers to ctxrouter_invokers.go. The handlers with params other
+// than string, int, int64, bool, float64, float32, uint64 and uint32 are skipped, they are called by reflection.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// importPath is the import path of ctxrouter in the generated file.
+const importPath = "github.com/ti/ctxrouter"
+
+// registrations are the methods of Router, Group and Registry which register handlers, with the index of their handler arg.
+var registrations = map[string]int{
+	"Get": 1, "Post": 1, "Put": 1, "Patch": 1, "Delete": 1, "Head": 1, "Options": 1, "All": 1,
+	"Handle": 2, "Handler": 1,
+}
+
+// conversions are the statements which convert a param to the supported types, %[1]s is the var and %[2]s is the param.
+// The conversion errors are discarded, because the router only calls a handler when Handler.accepts
+// has converted its params by strConv. Both have to accept the same strings, so a type is only added here
+// when strconv parses it like strConv does, and strConv must not reject what is converted here.
+var conversions = map[string][]string{
+	"string":  {"%[1]s := %[2]s"},
+	"int":     {"%[1]s, _ := strconv.Atoi(%[2]s)"},
+	"int64":   {"%[1]s, _ := strconv.ParseInt(%[2]s, 10, 64)"},
+	"bool":    {"%[1]s, _ := strconv.ParseBool(%[2]s)"},
+	"float64": {"%[1]s, _ := strconv.ParseFloat(%[2]s, 64)"},
+	"float32": {"%[1]s64, _ := strconv.ParseFloat(%[2]s, 32)", "%[1]s := float32(%[1]s64)"},
+	"uint64":  {"%[1]s, _ := strconv.ParseUint(%[2]s, 10, 64)"},
+	"uint32":  {"%[1]s64, _ := strconv.ParseUint(%[2]s, 10, 32)", "%[1]s := uint32(%[1]s64)"},
+}
+
+func main() {
+	output := flag.String("output", "ctxrouter_invokers.go", "the file name of generated invokers")
+	flag.Parse()
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	src, err := generate(dir, *output)
+	if err != nil {
+		log.Fatalf("ctxrouter-gen: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, *output), src, 0644); err != nil {
+		log.Fatalf("ctxrouter-gen: %v", err)
+	}
+}
+
+// handler is a context handler which an invoker is generated for.
+type handler struct {
+	// expr is the handler expression, exp: (*Context).Hello or Hello
+	expr string
+	// ctx is the context type, exp: Context or ctxrouter.Context
+	ctx string
+	// method reports whether the handler is a method of the context
+	method bool
+	// name is the name of method or func
+	name string
+	// params are the types of path params
+	params []string
+	// results is the number of results
+	results int
+}
+
+// generate returns the source of the invokers of the handlers registered in the package of dir.
+// The test files and the output file are not scanned.
+func generate(dir, output string) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var pkg string
+	var parsed []*ast.File
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") || filepath.Base(name) == output {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		pkg = f.Name.Name
+		parsed = append(parsed, f)
+	}
+	if pkg == "" {
+		return nil, fmt.Errorf("no go files in %s", dir)
+	}
+
+	funcs := make(map[string]*ast.FuncDecl)
+	for _, f := range parsed {
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok {
+				funcs[funcKey(fd)] = fd
+			}
+		}
+	}
+	handlers := make(map[string]handler)
+	for _, f := range parsed {
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			i, ok := registrations[sel.Sel.Name]
+			if !ok || len(call.Args) <= i {
+				return true
+			}
+			if h, ok := resolve(call.Args[i], funcs); ok {
+				handlers[h.expr] = h
+			}
+			return true
+		})
+	}
+	return render(pkg, handlers)
+}
+
+// funcKey returns the key of func declaration, exp: Hello for funcs and Context.Hello for the methods of *Context.
+func funcKey(fd *ast.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) != 1 {
+		return fd.Name.Name
+	}
+	if star, ok := fd.Recv.List[0].Type.(*ast.StarExpr); ok {
+		if id, ok := star.X.(*ast.Ident); ok {
+			return id.Name + "." + fd.Name.Name
+		}
+	}
+	return ""
+}
+
+// resolve returns the handler of the handler arg of a registration, if an invoker can be generated for it.
+func resolve(arg ast.Expr, funcs map[string]*ast.FuncDecl) (handler, bool) {
+	var h handler
+	var fd *ast.FuncDecl
+	switch e := arg.(type) {
+	case *ast.SelectorExpr:
+		//(*Context).Hello
+		paren, ok := e.X.(*ast.ParenExpr)
+		if !ok {
+			return h, false
+		}
+		star, ok := paren.X.(*ast.StarExpr)
+		if !ok {
+			return h, false
+		}
+		id, ok := star.X.(*ast.Ident)
+		if !ok {
+			return h, false
+		}
+		if fd = funcs[id.Name+"."+e.Sel.Name]; fd == nil {
+			return h, false
+		}
+		h = handler{expr: fmt.Sprintf("(*%s).%s", id.Name, e.Sel.Name), ctx: id.Name, method: true, name: e.Sel.Name}
+	case *ast.Ident:
+		//Hello(ctx *ctxrouter.Context, ...)
+		if fd = funcs[e.Name]; fd == nil || fd.Recv != nil || len(fd.Type.Params.List) == 0 {
+			return h, false
+		}
+		first := fd.Type.Params.List[0]
+		star, ok := first.Type.(*ast.StarExpr)
+		if !ok || len(first.Names) > 1 {
+			return h, false
+		}
+		ctx, ok := typeName(star.X)
+		if !ok {
+			return h, false
+		}
+		h = handler{expr: e.Name, ctx: ctx, name: e.Name}
+	default:
+		return h, false
+	}
+	params := fd.Type.Params.List
+	if !h.method {
+		//the context param
+		params = params[1:]
+	}
+	for _, field := range params {
+		t, ok := typeName(field.Type)
+		if !ok {
+			return h, false
+		}
+		if _, ok := conversions[t]; !ok {
+			return h, false
+		}
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			h.params = append(h.params, t)
+		}
+	}
+	if fd.Type.Results != nil {
+		for _, field := range fd.Type.Results.List {
+			if len(field.Names) == 0 {
+				h.results++
+			} else {
+				h.results += len(field.Names)
+			}
+		}
+	}
+	return h, true
+}
+
+// typeName returns the name of a local type or a type of ctxrouter, exp: int or ctxrouter.Context.
+func typeName(e ast.Expr) (string, bool) {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return t.Name, true
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "ctxrouter" {
+			return pkg.Name + "." + t.Sel.Name, true
+		}
+	}
+	return "", false
+}
+
+// render returns the formatted source of the invokers of handlers, in the order of their expressions.
+func render(pkg string, handlers map[string]handler) ([]byte, error) {
+	exprs := make([]string, 0, len(handlers))
+	useStrconv := false
+	for expr, h := range handlers {
+		exprs = append(exprs, expr)
+		for _, t := range h.params {
+			useStrconv = useStrconv || t != "string"
+		}
+	}
+	sort.Strings(exprs)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by ctxrouter-gen. DO NOT EDIT.\n\npackage %s\n", pkg)
+	if len(exprs) == 0 {
+		return format.Source(b.Bytes())
+	}
+	b.WriteString("\nimport (\n")
+	if useStrconv {
+		b.WriteString("\"strconv\"\n\n")
+	}
+	fmt.Fprintf(&b, "%q\n)\n\nfunc init() {\n", importPath)
+	for _, expr := range exprs {
+		h := handlers[expr]
+		fmt.Fprintf(&b, "ctxrouter.RegisterInvoker(%s, ctxrouter.Invoker{\n", h.expr)
+		fmt.Fprintf(&b, "New: func() ctxrouter.ContextInterface { return new(%s) },\n", h.ctx)
+		b.WriteString("Call: func(ctx ctxrouter.ContextInterface, params []string) []interface{} {\n")
+		args := make([]string, len(h.params))
+		for i, t := range h.params {
+			args[i] = fmt.Sprintf("p%d", i)
+			for _, stmt := range conversions[t] {
+				fmt.Fprintf(&b, stmt+"\n", args[i], fmt.Sprintf("params[%d]", i))
+			}
+		}
+		call := fmt.Sprintf("ctx.(*%s).%s(%s)", h.ctx, h.name, strings.Join(args, ", "))
+		if !h.method {
+			args = append([]string{fmt.Sprintf("ctx.(*%s)", h.ctx)}, args...)
+			call = fmt.Sprintf("%s(%s)", h.name, strings.Join(args, ", "))
+		}
+		if h.results == 0 {
+			fmt.Fprintf(&b, "%s\nreturn nil\n", call)
+		} else {
+			rets := make([]string, h.results)
+			for i := range rets {
+				rets[i] = fmt.Sprintf("r%d", i)
+			}
+			fmt.Fprintf(&b, "%s := %s\nreturn []interface{}{%s}\n", strings.Join(rets, ", "), call, strings.Join(rets, ", "))
+		}
+		b.WriteString("},\n})\n")
+	}
+	b.WriteString("}\n")
+	return format.Source(b.Bytes())
+}
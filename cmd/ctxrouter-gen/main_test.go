@@ -0,0 +1,137 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSource = `package app
+
+import "github.com/ti/ctxrouter"
+
+type Context struct {
+	ctxrouter.Context
+}
+
+type BookRequest struct {
+	ID int
+}
+
+func (c *Context) Hello(name string, id int) (interface{}, error) { return nil, nil }
+func (c *Context) Index()                                         {}
+func (c *Context) Book(req *BookRequest) (interface{}, error)     { return nil, nil }
+
+func Plain(ctx *ctxrouter.Context, id uint32) {}
+
+func routes(r *ctxrouter.Router) {
+	r.Get("/hello/{name}/{id}", (*Context).Hello)
+	r.Group("/v1").Handle("GET", "/", (*Context).Index)
+	r.Get("/books/{id}", (*Context).Book)
+	r.Get("/plain/{id}", Plain)
+}
+`
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.go"), []byte(testSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	//the previous output is not scanned
+	if err := os.WriteFile(filepath.Join(dir, "ctxrouter_invokers.go"), []byte("package app\n\nfunc broken("), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := generate(dir, "ctxrouter_invokers.go")
+	if err != nil {
+		t.Fatalf("generate(%q) failed with %v; want success", dir, err)
+	}
+	got := string(src)
+	for _, want := range []string{
+		"package app\n",
+		"ctxrouter.RegisterInvoker((*Context).Hello, ctxrouter.Invoker{",
+		"New: func() ctxrouter.ContextInterface { return new(Context) },",
+		"p1, _ := strconv.Atoi(params[1])",
+		"r0, r1 := ctx.(*Context).Hello(p0, p1)",
+		"return []interface{}{r0, r1}",
+		"ctx.(*Context).Index()\n\t\t\treturn nil",
+		"ctxrouter.RegisterInvoker(Plain, ctxrouter.Invoker{",
+		"return new(ctxrouter.Context)",
+		"p0 := uint32(p064)",
+		"Plain(ctx.(*ctxrouter.Context), p0)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("generate(%q) does not contain %q:\n%s", dir, want, got)
+		}
+	}
+	//the handlers with a request struct param are called by reflection
+	if strings.Contains(got, "(*Context).Book") {
+		t.Errorf("generate(%q) contains the invoker of (*Context).Book:\n%s", dir, got)
+	}
+
+	//the generated file compiles with the package against ctxrouter
+	if err := os.WriteFile(filepath.Join(dir, "ctxrouter_invokers.go"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := typeCheck(dir); err != nil {
+		t.Errorf("type check of the generated file failed with %v:\n%s", err, got)
+	}
+}
+
+// typeCheck type-checks the package of dir, ctxrouter is loaded from the source of this repository.
+func typeCheck(dir string) error {
+	fset := token.NewFileSet()
+	imp := &sourceImporter{fset: fset, root: filepath.Join("..", ".."), pkgs: make(map[string]*types.Package), std: importer.Default()}
+	_, err := imp.check(dir, "app")
+	return err
+}
+
+// sourceImporter imports ctxrouter and its packages from their source, and the other packages by the default importer.
+type sourceImporter struct {
+	fset *token.FileSet
+	// root is the directory of ctxrouter
+	root string
+	pkgs map[string]*types.Package
+	std  types.Importer
+}
+
+func (imp *sourceImporter) Import(path string) (*types.Package, error) {
+	if pkg, ok := imp.pkgs[path]; ok {
+		return pkg, nil
+	}
+	if path != importPath && !strings.HasPrefix(path, importPath+"/") {
+		return imp.std.Import(path)
+	}
+	pkg, err := imp.check(filepath.Join(imp.root, strings.TrimPrefix(path, importPath)), path)
+	if err != nil {
+		return nil, err
+	}
+	imp.pkgs[path] = pkg
+	return pkg, nil
+}
+
+// check type-checks the go files of dir except the test files.
+func (imp *sourceImporter) check(dir, path string) (*types.Package, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(imp.fset, name, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: imp}
+	return conf.Check(path, imp.fset, files, nil)
+}
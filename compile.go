@@ -73,6 +73,33 @@ func (v variable) compile() []cop {
 	return ops
 }
 
+func (m mixed) compile() []cop {
+	ops := []cop{{code: OpPush}}
+	parts := []segment(m)
+	if l, ok := parts[0].(literal); ok {
+		ops = append(ops, cop{code: OpTrimPrefix, str: string(l)})
+		parts = parts[1:]
+	}
+	if l, ok := parts[len(parts)-1].(literal); ok {
+		ops = append(ops, cop{code: OpTrimSuffix, str: string(l)})
+		parts = parts[:len(parts)-1]
+	}
+	// the variables and literals alternate now, and the first and the last parts are variables
+	for i := 0; i+1 < len(parts); i += 2 {
+		ops = append(ops, cop{
+			code: OpSplit,
+			str:  string(parts[i+1].(literal)),
+		}, cop{
+			code: OpCapture,
+			str:  parts[i].(variable).path,
+		})
+	}
+	return append(ops, cop{
+		code: OpCapture,
+		str:  parts[len(parts)-1].(variable).path,
+	})
+}
+
 func (t template) Compile() Template {
 	var rawOps []cop
 	for _, s := range t.segments {
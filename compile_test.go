@@ -95,6 +95,42 @@ func TestCompile(t *testing.T) {
 			pool:   []string{"obj", "a", "b", "name.nested"},
 			fields: []string{"name.nested", "obj"},
 		},
+		{
+			segs: []segment{
+				literal("files"),
+				mixed{
+					variable{path: "name", segments: []segment{wildcard{}}},
+					literal("."),
+					variable{path: "ext", segments: []segment{wildcard{}}},
+					literal(".gz"),
+				},
+			},
+			ops: []int{
+				int(OpLitPush), 0,
+				int(OpPush), operandFiller,
+				int(OpTrimSuffix), 1,
+				int(OpSplit), 2,
+				int(OpCapture), 3,
+				int(OpCapture), 4,
+			},
+			pool:   []string{"files", ".gz", ".", "name", "ext"},
+			fields: []string{"name", "ext"},
+		},
+		{
+			segs: []segment{
+				mixed{
+					literal("@"),
+					variable{path: "user", segments: []segment{wildcard{}}},
+				},
+			},
+			ops: []int{
+				int(OpPush), operandFiller,
+				int(OpTrimPrefix), 0,
+				int(OpCapture), 1,
+			},
+			pool:   []string{"@", "user"},
+			fields: []string{"user"},
+		},
 	} {
 		tmpl := template{
 			segments: spec.segs,
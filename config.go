@@ -0,0 +1,197 @@
+package ctxrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+//routeMethods the methods which the routes of route files can have, "*" is all methods
+var routeMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true, "*": true,
+}
+
+//Registry the handlers and middleware which the routes of a route file refer to by name, see Router.Load
+type Registry struct {
+	handlers   map[string]interface{}
+	middleware map[string]Middleware
+}
+
+//NewRegistry new empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers:   make(map[string]interface{}),
+		middleware: make(map[string]Middleware),
+	}
+}
+
+//Handler registers the handler by name, v is any handler which Router.Handle accepts
+func (reg *Registry) Handler(name string, v interface{}) *Registry {
+	reg.handlers[name] = v
+	return reg
+}
+
+//Middleware registers the middleware by name
+func (reg *Registry) Middleware(name string, m Middleware) *Registry {
+	reg.middleware[name] = m
+	return reg
+}
+
+//Config the routes of a route file, exp:
+//
+//	{"routes": [
+//		{"method": "GET", "template": "/v1/users/{id}", "handler": "users.get", "middleware": ["auth"], "meta": {"scope": "users"}},
+//		{"method": "DELETE", "template": "/v1/users/{id}", "handler": "users.delete", "disabled": true}
+//	]}
+type Config struct {
+	Routes []RouteConfig `json:"routes" yaml:"routes"`
+}
+
+//RouteConfig a route of route file, the disabled routes are validated but not registered.
+//Body selects where the request body is decoded into, see WithBody
+type RouteConfig struct {
+	Method     string                 `json:"method" yaml:"method"`
+	Template   string                 `json:"template" yaml:"template"`
+	Handler    string                 `json:"handler" yaml:"handler"`
+	Host       string                 `json:"host,omitempty" yaml:"host,omitempty"`
+	Name       string                 `json:"name,omitempty" yaml:"name,omitempty"`
+	Body       string                 `json:"body,omitempty" yaml:"body,omitempty"`
+	Middleware []string               `json:"middleware,omitempty" yaml:"middleware,omitempty"`
+	Meta       map[string]interface{} `json:"meta,omitempty" yaml:"meta,omitempty"`
+	Disabled   bool                   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+}
+
+//LoadJSON loads the routes of the json route file, the unknown fields are errors, see Load
+func (s *Router) LoadJSON(data []byte, reg *Registry) error {
+	return s.LoadConfig(data, json.Unmarshal, reg)
+}
+
+//LoadConfig loads the routes of route file which is decoded by unmarshal, see Load.
+//The route file is decoded into a map too, the keys which are no fields of Config or RouteConfig are errors
+func (s *Router) LoadConfig(data []byte, unmarshal func([]byte, interface{}) error, reg *Registry) error {
+	var cfg Config
+	if err := unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("invalid route file: %v", err)
+	}
+	var raw map[string]interface{}
+	if err := unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("invalid route file: %v", err)
+	}
+	if err := unknownFields(raw); err != nil {
+		return fmt.Errorf("invalid route file: %v", err)
+	}
+	return s.Load(cfg, reg)
+}
+
+//Load registers the routes of config with the handlers and middleware of registry in one update, see Tx.Load
+func (s *Router) Load(cfg Config, reg *Registry) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.Load(cfg, reg)
+	})
+}
+
+//Load registers the routes of config with the handlers and middleware of registry.
+//Every route is validated, the errors of all the invalid routes are joined in the returned error
+func (tx *Tx) Load(cfg Config, reg *Registry) error {
+	var errs []error
+	for i, rc := range cfg.Routes {
+		if err := tx.load(rc, reg); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s %s): %v", i, rc.Method, rc.Template, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+//load validates the route, and registers it if it is not disabled
+func (tx *Tx) load(rc RouteConfig, reg *Registry) error {
+	var errs []error
+	if rc.Method == "" {
+		errs = append(errs, errors.New("missing method"))
+	} else if !routeMethods[rc.Method] {
+		errs = append(errs, fmt.Errorf("invalid method %q", rc.Method))
+	}
+	if rc.Template == "" {
+		errs = append(errs, errors.New("missing template"))
+	}
+	v, ok := reg.handlers[rc.Handler]
+	if !ok {
+		errs = append(errs, fmt.Errorf("unknown handler %q", rc.Handler))
+	}
+	var opts []RouteOption
+	for _, name := range rc.Middleware {
+		m, ok := reg.middleware[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown middleware %q", name))
+		}
+		opts = append(opts, WithMiddleware(m))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if rc.Host != "" {
+		opts = append(opts, WithHost(rc.Host))
+	}
+	if rc.Name != "" {
+		opts = append(opts, WithName(rc.Name))
+	}
+	if rc.Body != "" {
+		opts = append(opts, WithBody(rc.Body))
+	}
+	for key, value := range rc.Meta {
+		opts = append(opts, WithMeta(key, value))
+	}
+	if rc.Disabled {
+		_, err := newHandler(rc.Template, v, opts, &tx.router.paramTypes)
+		return err
+	}
+	return tx.Handle(rc.Method, rc.Template, v, opts...)
+}
+
+//configFields and routeFields the keys of the route file, which are the json names of the fields of Config and RouteConfig
+var configFields, routeFields = fieldNames(reflect.TypeOf(Config{})), fieldNames(reflect.TypeOf(RouteConfig{}))
+
+//fieldNames returns the json names of the fields of struct type
+func fieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		names[tagName(t.Field(i).Tag.Get("json"))] = true
+	}
+	return names
+}
+
+//unknownFields checks the keys of the decoded route file, the errors of all the unknown keys are joined
+func unknownFields(raw map[string]interface{}) error {
+	var errs []error
+	for _, key := range mapKeys(raw) {
+		if !configFields[key] {
+			errs = append(errs, fmt.Errorf("unknown field %q", key))
+		}
+	}
+	routes, _ := raw["routes"].([]interface{})
+	for i, route := range routes {
+		for _, key := range mapKeys(route) {
+			if !routeFields[key] {
+				errs = append(errs, fmt.Errorf("route %d: unknown field %q", i, key))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+//mapKeys returns the sorted keys of the decoded map, the keys of the maps decoded by some unmarshal are not strings
+func mapKeys(v interface{}) []string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map {
+		return nil
+	}
+	keys := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		keys = append(keys, fmt.Sprint(k.Interface()))
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -17,6 +17,13 @@ const (
 	OpConcatN
 	// OpCapture pops an item and binds it to the variable
 	OpCapture
+	// OpTrimPrefix removes the literal from the start of the item on the top of stack, the rest must not be empty
+	OpTrimPrefix
+	// OpTrimSuffix removes the literal from the end of the item on the top of stack, the rest must not be empty
+	OpTrimSuffix
+	// OpSplit pops an item, splits it at the first occurrence of the literal,
+	// then pushes the part after the literal and the part before it. Both parts must not be empty
+	OpSplit
 	// OpEnd is the least positive invalid opcode.
 	OpEnd
 )
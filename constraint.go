@@ -0,0 +1,179 @@
+package ctxrouter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+//constraint restricts the values captured by a path variable, exp: {id:int}, {id:uuid}, {code:[a-z]{2}}
+type constraint struct {
+	//expr the constraint in template
+	expr  string
+	match func(string) bool
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+//constraintKinds the named constraints, the other constraints are regular expressions which match the whole value
+var constraintKinds = map[string]func(string) bool{
+	"int": func(v string) bool {
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	},
+	"uint": func(v string) bool {
+		_, err := strconv.ParseUint(v, 10, 64)
+		return err == nil
+	},
+	"float": func(v string) bool {
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	},
+	"bool": func(v string) bool {
+		_, err := strconv.ParseBool(v)
+		return err == nil
+	},
+	"uuid": uuidPattern.MatchString,
+	"alpha": func(v string) bool {
+		for i := 0; i < len(v); i++ {
+			if c := v[i] | 0x20; c < 'a' || c > 'z' {
+				return false
+			}
+		}
+		return v != ""
+	},
+}
+
+func newConstraint(expr string) (constraint, error) {
+	if match, ok := constraintKinds[expr]; ok {
+		return constraint{expr: expr, match: match}, nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return constraint{}, err
+	}
+	return constraint{expr: expr, match: re.MatchString}, nil
+}
+
+//parseConstraints removes the constraints from the variables of template, exp: /items/{id:int} to /items/{id},
+//and returns the constraints indexed by the field paths of variables
+func parseConstraints(template string) (string, map[string]constraint, error) {
+	var constraints map[string]constraint
+	for i := 0; i < len(template); i++ {
+		if template[i] != '{' {
+			continue
+		}
+		j := i + 1
+		for j < len(template) && (isIdentByte(template[j]) || template[j] == '.') {
+			j++
+		}
+		if j == len(template) || template[j] != ':' {
+			continue
+		}
+		//braces are balanced in regular expressions, exp: [a-z]{2}
+		depth, k := 1, j+1
+		for ; k < len(template); k++ {
+			if template[k] == '{' {
+				depth++
+			} else if template[k] == '}' {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+		}
+		if k == len(template) {
+			return "", nil, errors.New("unterminated variable constraint: " + template)
+		}
+		field := template[i+1 : j]
+		c, err := newConstraint(template[j+1 : k])
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid constraint of variable %s: %v", field, err)
+		}
+		if constraints == nil {
+			constraints = make(map[string]constraint)
+		}
+		constraints[field] = c
+		template = template[:j] + template[k:]
+	}
+	return template, constraints, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+//satisfies checks if the values bound to the variables of handler satisfy their constraints
+func (h *Handler) satisfies(ps *PathParams) bool {
+	for field, c := range h.constraints {
+		if v, _ := ps.Get(field); !c.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+//constraintExpr returns the constraint of the ith variable of handler, the types of handler params
+//or request struct fields other than string are the constraints of the variables without constraint
+func (h *Handler) constraintExpr(i int) string {
+	if c, ok := h.constraints[h.Pat.vars[i]]; ok {
+		return c.expr
+	}
+	if h.request != nil {
+		if f, ok := h.request.fields[h.Pat.vars[i]]; ok && f.typ.Kind() != reflect.String {
+			return f.typ.String()
+		}
+		return ""
+	}
+	//the params of host variables are before the params of path variables
+	if j := len(h.paramsT) - len(h.Pat.vars) + i; j >= 0 && h.paramsT[j].Kind() != reflect.String {
+		return h.paramsT[j].String()
+	}
+	return ""
+}
+
+//constrained checks if any variable of handler has a constraint, see constraintExpr
+func (h *Handler) constrained() bool {
+	for i := range h.Pat.vars {
+		if h.constraintExpr(i) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+//sameConstraints checks if the variables of two handlers with equivalent patterns have the same constraints
+func sameConstraints(a, b *Handler) bool {
+	if len(a.Pat.vars) != len(b.Pat.vars) {
+		return false
+	}
+	for i := range a.Pat.vars {
+		if a.constraintExpr(i) != b.constraintExpr(i) {
+			return false
+		}
+	}
+	return true
+}
+
+//sameTemplate checks if two handlers have the same template after parsing, including the constraints of variables
+func sameTemplate(a, b *Handler) bool {
+	if a.Pat.String() != b.Pat.String() || len(a.constraints) != len(b.constraints) {
+		return false
+	}
+	for field, c := range a.constraints {
+		if b.constraints[field].expr != c.expr {
+			return false
+		}
+	}
+	return true
+}
+
+//precedes reports whether h is tried before e, see Pattern.precedes.
+//Among the routes whose patterns have the same precedence, the routes with constraints are tried first
+func (h *Handler) precedes(e *Handler) bool {
+	if h.Pat.precedes(e.Pat) {
+		return true
+	}
+	return h.constrained() && !e.constrained() && !e.Pat.precedes(h.Pat)
+}
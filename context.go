@@ -35,6 +35,12 @@ func (c *Context) DecodeRequest() error {
 	return nil
 }
 
+//DecodeBody decodes the request body into v by the codec of Content-Type, json by default,
+//the body params and request structs are decoded by it, see BodyDecoder
+func (c *Context) DecodeBody(v interface{}) error {
+	return decodeBody(c.Request, v)
+}
+
 //DecodeJSON decode json
 func (c *Context) DecodeJSON(data interface{}) error {
 	decoder := json.NewDecoder(c.Request.Body)
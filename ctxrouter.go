@@ -1,10 +1,13 @@
 package ctxrouter
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/ti/ctxrouter/errors"
 	"net/http"
+	"net/url"
 	"reflect"
+	"strings"
 )
 
 //Params get params form request (It is faster than most other function, because there is no extra compute )
@@ -15,6 +18,14 @@ func Params(req *http.Request) []string {
 
 const paramHeader = "X-Ctxrouter-Params"
 
+type metaKey struct{}
+
+//Meta get the metadata of the matched route from request, it is nil if the route has no metadata
+func Meta(req *http.Request) map[string]interface{} {
+	meta, _ := req.Context().Value(metaKey{}).(map[string]interface{})
+	return meta
+}
+
 //ContextInterface the interface of any context
 //the context must have Init and DecodeRequest
 type ContextInterface interface {
@@ -22,40 +33,151 @@ type ContextInterface interface {
 	DecodeRequest() error
 }
 
+//BodyDecoder the context which decodes the request body into the body params and request structs, see WithBody.
+//Context decodes it by the codec of Content-Type
+type BodyDecoder interface {
+	DecodeBody(v interface{}) error
+}
+
 //New new router
 func New() *Router {
 	return &Router{
-		handlers: make(map[string][]Handler),
+		HandleHEAD:            true,
+		HandleOPTIONS:         true,
+		RedirectTrailingSlash: true,
+		RedirectFixedPath:     true,
 	}
 }
 
 //ServeHTTP just used by system http handler
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	val, _, params, err := r.Match(req.Method, req.URL.Path)
+	ps := paramsPool.Get().(*PathParams)
+	ps.reset()
+	val, err := r.match(req, req.Method, req.Host, req.URL.EscapedPath(), ps)
+	if err != nil && req.Method == "HEAD" && r.HandleHEAD {
+		val, err = r.match(req, "GET", req.Host, req.URL.EscapedPath(), ps)
+		if err == nil && val.noAutoHead {
+			err = ErrNotMatch
+		}
+		w = headResponseWriter{w}
+	}
+	if err == nil && r.RedirectTrailingSlash && val.Pat.emptyTrailingCapture(req.URL.EscapedPath()) {
+		//the path with a trailing slash is served by a variable which captures the empty last segment,
+		//it is redirected if the path without the slash is served, see served
+		if p, ok := r.redirect(req); ok {
+			paramsPool.Put(ps)
+			r.redirectTo(w, req, p)
+			return
+		}
+	}
 	if err != nil {
-		http.NotFound(w, req)
+		paramsPool.Put(ps)
+		if p, ok := r.redirect(req); ok {
+			r.redirectTo(w, req, p)
+			return
+		}
+		if allow := r.allowed(req); len(allow) > 0 {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			if req.Method == "OPTIONS" && r.HandleOPTIONS && contains(allow, "OPTIONS") {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if r.MethodNotAllowed != nil {
+				r.MethodNotAllowed.ServeHTTP(w, req)
+			} else {
+				methodNotAllowed(w, req)
+			}
+			return
+		}
+		if r.NotFound != nil {
+			r.NotFound.ServeHTTP(w, req)
+		} else {
+			notFound(w, req)
+		}
 		return
 	}
-	if val.callT == nil {
-		req.Header[paramHeader] = params
-		if h, ok := val.callV.Interface().(http.HandlerFunc); ok {
-			h.ServeHTTP(w, req)
-		} else if hf, ok := val.callV.Interface().(func(http.ResponseWriter, *http.Request)); ok {
-			hf(w, req)
+	if len(val.middleware) > 0 {
+		//the middleware may keep serving the request after ServeHTTP returns, exp: http.TimeoutHandler,
+		//so the params are copied instead of pooled
+		owned := ps.clone()
+		paramsPool.Put(ps)
+		ps = owned
+	} else {
+		defer paramsPool.Put(ps)
+	}
+	if len(val.Meta) > 0 {
+		req = req.WithContext(context.WithValue(req.Context(), metaKey{}, val.Meta))
+	}
+	if len(val.middleware) == 0 {
+		r.serve(w, req, val, ps)
+		return
+	}
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.serve(w, req, val, ps)
+	})
+	for i := len(val.middleware) - 1; i >= 0; i-- {
+		h = val.middleware[i](h)
+	}
+	h.ServeHTTP(w, req)
+}
+
+//redirectTo redirects the request to the escaped path p, the query is kept
+func (r *Router) redirectTo(w http.ResponseWriter, req *http.Request, p string) {
+	code := http.StatusPermanentRedirect
+	if req.Method == "GET" || req.Method == "HEAD" {
+		code = http.StatusMovedPermanently
+	}
+	//the redirects of a mounted router keep the stripped prefix
+	p = mountPrefix(req) + p
+	u := *req.URL
+	u.Path, _ = url.PathUnescape(p)
+	u.RawPath = p
+	http.Redirect(w, req, u.String(), code)
+}
+
+//serve calls the handler of the matched route
+func (r *Router) serve(w http.ResponseWriter, req *http.Request, val *Handler, ps *PathParams) {
+	if val.handler != nil {
+		//the params of request are owned by it, the http handlers may keep them after ServeHTTP returns
+		params := ps.List()
+		if prefix := mountParams(req); len(prefix) > 0 {
+			params = append(prefix[:len(prefix):len(prefix)], params...)
 		}
+		req.Header[paramHeader] = params
+		val.handler.ServeHTTP(w, req)
+		return
+	}
+	if val.typed != nil {
+		val.typed.serve(r, w, req, val, ps)
 		return
 	}
-	ctx := reflect.New(val.callT).Interface().(ContextInterface)
+	var ctx ContextInterface
+	if val.invoker != nil {
+		ctx = val.invoker.New()
+	} else {
+		ctx = reflect.New(val.callT).Interface().(ContextInterface)
+	}
 	ctx.Init(w, req)
 	if err := ctx.DecodeRequest(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		r.decodeFailed(w, req, err)
 		return
 	}
-	in := []reflect.Value{reflect.ValueOf(ctx)}
-	if val.hasParams {
-		in = append(in, val.paramsV...)
+	var rets []reflect.Value
+	if val.invoker != nil {
+		rets = resultValues(val.invoker.Call(ctx, ps.list()))
+	} else {
+		//the args of few params are kept on the stack
+		var buf [maxParams + 2]reflect.Value
+		in := append(buf[:0], reflect.ValueOf(ctx))
+		if val.hasParams {
+			var err error
+			if in, err = val.args(in, ctx, req, ps, r.DisallowUnknownQuery); err != nil {
+				r.decodeFailed(w, req, err)
+				return
+			}
+		}
+		rets = val.callV.Call(in)
 	}
-	rets := val.callV.Call(in)
 	var statusError Error
 	var data interface{}
 	var dataOK bool
@@ -72,6 +194,11 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	} else {
 		return
 	}
+	respond(w, data, dataOK, statusError)
+}
+
+//respond encodes the results of handler to json, the data is written only if dataOK
+func respond(w http.ResponseWriter, data interface{}, dataOK bool, statusError Error) {
 	if statusError == nil {
 		if dataOK {
 			if d, err := json.Marshal(data); err == nil {
@@ -93,6 +220,59 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	w.Write(d)
 }
 
+//headResponseWriter discards the body written by the GET handler which serves a HEAD request
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+//methodNotAllowed the default MethodNotAllowed handler of router
+func methodNotAllowed(w http.ResponseWriter, req *http.Request) {
+	err := errors.CodeError(errors.Unimplemented).WithDescription("method " + req.Method + " not allowed")
+	JSONResponseVerbose(w, http.StatusMethodNotAllowed, nil, err)
+}
+
+//notFound the default NotFound handler of router
+func notFound(w http.ResponseWriter, req *http.Request) {
+	err := errors.CodeError(errors.NotFound).WithDescription("path " + req.URL.Path + " not found")
+	JSONResponseVerbose(w, http.StatusNotFound, nil, err)
+}
+
+//decodeFailed responds the error of decoding request by the DecodeError of router
+func (r *Router) decodeFailed(w http.ResponseWriter, req *http.Request, err error) {
+	if r.DecodeError != nil {
+		r.DecodeError(w, req, err)
+	} else {
+		decodeError(w, req, err)
+	}
+}
+
+//decodeError the default DecodeError handler of router
+func decodeError(w http.ResponseWriter, req *http.Request, err error) {
+	if e, ok := err.(Error); ok && !e.IsNil() {
+		statusCode := e.StatusCode()
+		if statusCode <= 0 {
+			statusCode = http.StatusBadRequest
+		}
+		JSONResponseVerbose(w, statusCode, nil, e)
+		return
+	}
+	e := errors.CodeError(errors.InvalidArgument).WithDescription(err.Error())
+	JSONResponseVerbose(w, http.StatusBadRequest, nil, e)
+}
+
 //errorFromValue bool is if the error is nil
 func errorFromValue(v reflect.Value) Error {
 	if v.IsNil() {
@@ -116,57 +296,57 @@ func errorFromValue(v reflect.Value) Error {
 }
 
 //Get http Get method
-func (r *Router) Get(path string, controller interface{}) {
-	if err := r.Handle("GET", path, controller); err != nil {
+func (r *Router) Get(path string, controller interface{}, opts ...RouteOption) {
+	if err := r.Handle("GET", path, controller, opts...); err != nil {
 		panic(err)
 	}
 }
 
 //Post http Post method
-func (r *Router) Post(path string, controller interface{}) {
-	if err := r.Handle("POST", path, controller); err != nil {
+func (r *Router) Post(path string, controller interface{}, opts ...RouteOption) {
+	if err := r.Handle("POST", path, controller, opts...); err != nil {
 		panic(err)
 	}
 }
 
 //Patch http Patch method
-func (r *Router) Patch(path string, controller interface{}) {
-	if err := r.Handle("PATCH", path, controller); err != nil {
+func (r *Router) Patch(path string, controller interface{}, opts ...RouteOption) {
+	if err := r.Handle("PATCH", path, controller, opts...); err != nil {
 		panic(err)
 	}
 }
 
 //Put http Put method
-func (r *Router) Put(path string, controller interface{}) {
-	if err := r.Handle("PUT", path, controller); err != nil {
+func (r *Router) Put(path string, controller interface{}, opts ...RouteOption) {
+	if err := r.Handle("PUT", path, controller, opts...); err != nil {
 		panic(err)
 	}
 }
 
 //Delete http Delete method
-func (r *Router) Delete(path string, controller interface{}) {
-	if err := r.Handle("DELETE", path, controller); err != nil {
+func (r *Router) Delete(path string, controller interface{}, opts ...RouteOption) {
+	if err := r.Handle("DELETE", path, controller, opts...); err != nil {
 		panic(err)
 	}
 }
 
 //Head http Head method
-func (r *Router) Head(path string, controller interface{}) {
-	if err := r.Handle("HEAD", path, controller); err != nil {
+func (r *Router) Head(path string, controller interface{}, opts ...RouteOption) {
+	if err := r.Handle("HEAD", path, controller, opts...); err != nil {
 		panic(err)
 	}
 }
 
 //Options http Options method
-func (r *Router) Options(path string, controller interface{}) {
-	if err := r.Handle("OPTIONS", path, controller); err != nil {
+func (r *Router) Options(path string, controller interface{}, opts ...RouteOption) {
+	if err := r.Handle("OPTIONS", path, controller, opts...); err != nil {
 		panic(err)
 	}
 }
 
 //All http all method
-func (r *Router) All(path string, controller interface{}) {
-	if err := r.Handle("*", path, controller); err != nil {
+func (r *Router) All(path string, controller interface{}, opts ...RouteOption) {
+	if err := r.Handle("*", path, controller, opts...); err != nil {
 		panic(err)
 	}
 }
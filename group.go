@@ -0,0 +1,105 @@
+package ctxrouter
+
+import (
+	"strings"
+)
+
+//Group registers routes under a shared path prefix, with shared middleware and metadata
+type Group struct {
+	router *Router
+	prefix string
+	opts   []RouteOption
+}
+
+//Group new group of routes whose templates start with prefix, exp: /v1/projects/{project}
+//the variables of prefix are bound to handler params before the variables of route
+func (s *Router) Group(prefix string) *Group {
+	return &Group{router: s, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+//Group new nested group, it inherits the prefix, middleware and metadata of current group
+func (g *Group) Group(prefix string) *Group {
+	return &Group{
+		router: g.router,
+		prefix: g.prefix + strings.TrimSuffix(prefix, "/"),
+		opts:   g.options(),
+	}
+}
+
+//Use add middleware to the routes registered after it, the first one is the outermost
+func (g *Group) Use(middleware ...Middleware) *Group {
+	g.opts = append(g.options(), WithMiddleware(middleware...))
+	return g
+}
+
+//Meta set metadata of the routes registered after it
+func (g *Group) Meta(key string, value interface{}) *Group {
+	g.opts = append(g.options(), WithMeta(key, value))
+	return g
+}
+
+//options returns a copy of group options, so that nested groups never share the backing array
+func (g *Group) options() []RouteOption {
+	return append([]RouteOption(nil), g.opts...)
+}
+
+//Handle handler path in group, path is appended to the prefix of group
+func (g *Group) Handle(method, path string, v interface{}, opts ...RouteOption) error {
+	return g.router.Handle(method, g.prefix+path, v, append(g.options(), opts...)...)
+}
+
+//Get http Get method
+func (g *Group) Get(path string, controller interface{}, opts ...RouteOption) {
+	if err := g.Handle("GET", path, controller, opts...); err != nil {
+		panic(err)
+	}
+}
+
+//Post http Post method
+func (g *Group) Post(path string, controller interface{}, opts ...RouteOption) {
+	if err := g.Handle("POST", path, controller, opts...); err != nil {
+		panic(err)
+	}
+}
+
+//Patch http Patch method
+func (g *Group) Patch(path string, controller interface{}, opts ...RouteOption) {
+	if err := g.Handle("PATCH", path, controller, opts...); err != nil {
+		panic(err)
+	}
+}
+
+//Put http Put method
+func (g *Group) Put(path string, controller interface{}, opts ...RouteOption) {
+	if err := g.Handle("PUT", path, controller, opts...); err != nil {
+		panic(err)
+	}
+}
+
+//Delete http Delete method
+func (g *Group) Delete(path string, controller interface{}, opts ...RouteOption) {
+	if err := g.Handle("DELETE", path, controller, opts...); err != nil {
+		panic(err)
+	}
+}
+
+//Head http Head method
+func (g *Group) Head(path string, controller interface{}, opts ...RouteOption) {
+	if err := g.Handle("HEAD", path, controller, opts...); err != nil {
+		panic(err)
+	}
+}
+
+//Options http Options method
+func (g *Group) Options(path string, controller interface{}, opts ...RouteOption) {
+	if err := g.Handle("OPTIONS", path, controller, opts...); err != nil {
+		panic(err)
+	}
+}
+
+//All http all method
+func (g *Group) All(path string, controller interface{}, opts ...RouteOption) {
+	if err := g.Handle("*", path, controller, opts...); err != nil {
+		panic(err)
+	}
+}
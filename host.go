@@ -0,0 +1,105 @@
+package ctxrouter
+
+import (
+	"net"
+	"strings"
+)
+
+//hostTable the routes of a host template
+type hostTable struct {
+	*table
+	template string
+	pat      Pattern
+}
+
+//Host new group of routes which only match the requests whose host matches the host template,
+//the template has the same syntax as path, but the segments are separated by ".", exp: {tenant}.api.example.com
+//the variables of host are bound to handler params and Params(req) before the variables of path
+func (s *Router) Host(template string) *Group {
+	return &Group{router: s, opts: []RouteOption{WithHost(template)}}
+}
+
+//WithHost only match the route when the host of request matches the host template, see Router.Host
+func WithHost(template string) RouteOption {
+	return func(h *Handler) {
+		h.host = template
+	}
+}
+
+//hostTable returns the route table of the host template, it is created if it does not exist
+func (s *snapshot) hostTable(template string) (*table, error) {
+	path := hostPath(template)
+	for _, ht := range s.hosts {
+		if hostPath(ht.template) == path {
+			return ht.table, nil
+		}
+	}
+	pat, err := ParsePatternURL(path)
+	if err != nil {
+		return nil, err
+	}
+	ht := &hostTable{table: newTable(s.gen), template: template, pat: pat}
+	i := len(s.hosts)
+	for i > 0 && pat.precedes(s.hosts[i-1].pat) {
+		i--
+	}
+	s.hosts = append(s.hosts, nil)
+	copy(s.hosts[i+1:], s.hosts[i:])
+	s.hosts[i] = ht
+	return ht.table, nil
+}
+
+//tables calls fn with the route tables which may serve the host, the params captured by their host templates are set to ps.
+//The routes without host template are the last ones. tables stops as soon as fn returns true.
+func (s *snapshot) tables(host string, ps *PathParams, fn func(t *table) bool) {
+	if host != "" && len(s.hosts) > 0 {
+		components := strings.Split(hostname(host), ".")
+		for _, ht := range s.hosts {
+			ps.reset()
+			if !ht.pat.match(components, "", ps) {
+				continue
+			}
+			//multiple labels are captured by ** with "/" between them
+			for i := 0; i < ps.n; i++ {
+				ps.set(i, strings.Replace(ps.Value(i), "/", ".", -1))
+			}
+			ps.hostVars, ps.vars = ps.vars, nil
+			if fn(ht.table) {
+				return
+			}
+		}
+	}
+	ps.reset()
+	fn(s.routes)
+}
+
+//hostPath converts the host template to a path template, exp: {tenant}.example.com to /{tenant}/example/com
+//the literals of host are case-insensitive, so they are lower cased
+func hostPath(template string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	var depth int
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == '.' && depth == 0:
+			c = '/'
+		case depth == 0 && 'A' <= c && c <= 'Z':
+			c += 'a' - 'A'
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+//hostname returns the lower cased host without port
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
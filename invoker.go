@@ -0,0 +1,57 @@
+package ctxrouter
+
+import (
+	"reflect"
+	"sync"
+)
+
+//Invoker calls a context handler without reflection, it is generated by cmd/ctxrouter-gen, see RegisterInvoker
+type Invoker struct {
+	//New returns a new context of the handler
+	New func() ContextInterface
+	//Call calls the handler with the context and the path params in order, and returns the results of handler
+	Call func(ctx ContextInterface, params []string) []interface{}
+}
+
+var invokers struct {
+	sync.RWMutex
+	m map[uintptr]Invoker
+}
+
+//RegisterInvoker registers the invoker of handler, exp: (*Context).Hello,
+//the routes of handler registered after it are served by the invoker instead of reflection.
+//The handlers with a request struct param are always served by reflection
+func RegisterInvoker(handler interface{}, inv Invoker) {
+	rv := reflect.ValueOf(handler)
+	if rv.Kind() != reflect.Func {
+		panic("ctxrouter: invoker of a handler which is not a func")
+	}
+	invokers.Lock()
+	defer invokers.Unlock()
+	if invokers.m == nil {
+		invokers.m = make(map[uintptr]Invoker)
+	}
+	invokers.m[rv.Pointer()] = inv
+}
+
+//lookupInvoker returns the invoker of handler, it is nil if there is none
+func lookupInvoker(handler reflect.Value) *Invoker {
+	invokers.RLock()
+	defer invokers.RUnlock()
+	if inv, ok := invokers.m[handler.Pointer()]; ok {
+		return &inv
+	}
+	return nil
+}
+
+//resultValues returns the results of invoker as the results of reflect.Value.Call
+func resultValues(rets []interface{}) []reflect.Value {
+	values := make([]reflect.Value, len(rets))
+	for i := range rets {
+		if values[i] = reflect.ValueOf(rets[i]); !values[i].IsValid() {
+			//a nil interface result
+			values[i] = reflect.ValueOf(&rets[i]).Elem()
+		}
+	}
+	return values
+}
@@ -0,0 +1,95 @@
+package ctxrouter
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+//Matcher checks the request after the path of route matches,
+//when it returns false, the next route which matches the path is tried
+type Matcher func(*http.Request) bool
+
+//WithMatcher only match the route when all of the matchers accept the request
+func WithMatcher(matchers ...Matcher) RouteOption {
+	return func(h *Handler) {
+		h.matchers = append(h.matchers[:len(h.matchers):len(h.matchers)], matchers...)
+	}
+}
+
+//matches checks if all the matchers of handler accept the request
+func (h *Handler) matches(req *http.Request) bool {
+	for _, m := range h.matchers {
+		if !m(req) {
+			return false
+		}
+	}
+	return true
+}
+
+//MatchHeader match the requests which have the header key, if value is not empty, the header must equal to it
+func MatchHeader(key, value string) Matcher {
+	key = http.CanonicalHeaderKey(key)
+	return func(req *http.Request) bool {
+		values, ok := req.Header[key]
+		if !ok || value == "" {
+			return ok
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//MatchQuery match the requests which have the query key, if value is not empty, the query must equal to it
+//exp: MatchQuery("alt", "media")
+func MatchQuery(key, value string) Matcher {
+	return func(req *http.Request) bool {
+		values, ok := req.URL.Query()[key]
+		if !ok || value == "" {
+			return ok
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//MatchContentType match the requests whose Content-Type is one of the media types, the parameters are ignored
+//exp: MatchContentType("application/json", "application/merge-patch+json")
+func MatchContentType(mediaTypes ...string) Matcher {
+	return func(req *http.Request) bool {
+		mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil {
+			return false
+		}
+		for _, t := range mediaTypes {
+			if strings.EqualFold(t, mediaType) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//MatchAcceptParam match the requests which accept a media type with the parameter,
+//exp: MatchAcceptParam("version", "2") matches "Accept: application/json; version=2"
+func MatchAcceptParam(name, value string) Matcher {
+	return func(req *http.Request) bool {
+		for _, accept := range req.Header["Accept"] {
+			for _, mediaRange := range strings.Split(accept, ",") {
+				_, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+				if err == nil && params[strings.ToLower(name)] == value {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,113 @@
+package ctxrouter
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//mountVar the variable which captures the rest of path under the prefix of a mounted handler
+const mountVar = "ctxrouter_mount"
+
+type mountKey struct{}
+
+type mountPrefixKey struct{}
+
+//mountParams returns the params captured by the prefixes of the mounted handlers which serve the request
+func mountParams(req *http.Request) []string {
+	params, _ := req.Context().Value(mountKey{}).([]string)
+	return params
+}
+
+//mountPrefix returns the escaped path prefixes stripped by the mounted handlers which serve the request,
+//the redirects of a mounted router are prefixed by it
+func mountPrefix(req *http.Request) string {
+	prefix, _ := req.Context().Value(mountPrefixKey{}).(string)
+	return prefix
+}
+
+//Mount mount any http.Handler (include another *Router) at prefix for all methods,
+//exp: r.Mount("/static", http.FileServer(http.Dir(dir))) , r.Mount("/v1/tenants/{tenant}", tenantRouter)
+//the prefix is stripped from the request path before it is served,
+//and the variables of prefix are the first params of Params(req) in the mounted handler
+func (s *Router) Mount(prefix string, h http.Handler, opts ...RouteOption) {
+	m, err := newMount(prefix, h)
+	if err == nil {
+		err = s.Handle("*", mountPath(prefix), m, opts...)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+//Mount mount any http.Handler at prefix for all methods, the prefix is appended to the prefix of group
+func (g *Group) Mount(prefix string, h http.Handler, opts ...RouteOption) {
+	m, err := newMount(g.prefix+prefix, h)
+	if err == nil {
+		err = g.Handle("*", mountPath(prefix), m, opts...)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+//mount strips the prefix of the request path, then serves the request by the mounted handler
+type mount struct {
+	handler http.Handler
+	//depth is the number of path segments of the prefix
+	depth int
+}
+
+//mountPath returns the path template which a handler is mounted with
+func mountPath(prefix string) string {
+	return strings.TrimSuffix(prefix, "/") + "/{" + mountVar + "=**}"
+}
+
+//newMount returns the mount of handler at the full prefix
+func newMount(prefix string, h http.Handler) (mount, error) {
+	pattern, _, err := parseTemplate(mountPath(prefix))
+	if err != nil {
+		return mount{}, err
+	}
+	return mount{handler: h, depth: len(pattern.steps()) - 1}, nil
+}
+
+func (m mount) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	params := Params(req)
+	if len(params) > 0 {
+		params = params[:len(params)-1]
+		req.Header[paramHeader] = params
+	}
+	r := new(http.Request)
+	*r = *req
+	r.URL = new(url.URL)
+	*r.URL = *req.URL
+	//the prefix is matched by the segments of the escaped path, which may contain escaped "/"
+	path := req.URL.EscapedPath()
+	escaped := stripSegments(path, m.depth)
+	prefix := path
+	if strings.HasSuffix(path, escaped) {
+		prefix = path[:len(path)-len(escaped)]
+	}
+	r.URL.Path, _ = url.PathUnescape(escaped)
+	r.URL.RawPath = ""
+	if r.URL.EscapedPath() != escaped {
+		r.URL.RawPath = escaped
+	}
+	ctx := context.WithValue(req.Context(), mountKey{}, params)
+	ctx = context.WithValue(ctx, mountPrefixKey{}, mountPrefix(req)+prefix)
+	m.handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+//stripSegments removes the first n segments of path, the result always starts with "/"
+func stripSegments(path string, n int) string {
+	for i := 0; i < n; i++ {
+		idx := strings.IndexByte(path[1:], '/')
+		if idx < 0 {
+			return "/"
+		}
+		path = path[idx+1:]
+	}
+	return path
+}
@@ -0,0 +1,195 @@
+package ctxrouter
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+//maxParams the number of values which PathParams holds without allocation
+const maxParams = 8
+
+//PathParams the values captured by the variables of a matched route, the variables of host template first.
+//The values are kept in an array of fixed capacity, so that matching a route does not allocate,
+//the map of them is only built when Map is called
+type PathParams struct {
+	//hostVars and vars the field paths of the variables of host template and path template
+	hostVars, vars []string
+	values         [maxParams]string
+	//more the values beyond the capacity of values
+	more []string
+	n    int
+	//converted the storage of the values converted by convert, it is reused by the next matches
+	converted [maxParams]reflect.Value
+}
+
+//paramsPool the PathParams used by ServeHTTP, they are only given to the handlers which can not outlive it
+var paramsPool = sync.Pool{New: func() interface{} { return new(PathParams) }}
+
+//Len returns the number of params
+func (ps *PathParams) Len() int {
+	return ps.n
+}
+
+//Name returns the field path of the variable of the ith param
+func (ps *PathParams) Name(i int) string {
+	if i < len(ps.hostVars) {
+		return ps.hostVars[i]
+	}
+	return ps.vars[i-len(ps.hostVars)]
+}
+
+//Value returns the value of the ith param
+func (ps *PathParams) Value(i int) string {
+	if i < maxParams {
+		return ps.values[i]
+	}
+	return ps.more[i-maxParams]
+}
+
+//Get returns the value of the variable, the variables of path template hide the ones of host template
+func (ps *PathParams) Get(name string) (string, bool) {
+	for i := ps.n - 1; i >= 0; i-- {
+		if ps.Name(i) == name {
+			return ps.Value(i), true
+		}
+	}
+	return "", false
+}
+
+//Map returns a new map from the field paths of variables to their values
+func (ps *PathParams) Map() map[string]string {
+	m := make(map[string]string, ps.n)
+	for i := 0; i < ps.n; i++ {
+		m[ps.Name(i)] = ps.Value(i)
+	}
+	return m
+}
+
+//List returns a new slice of the values in order
+func (ps *PathParams) List() []string {
+	list := make([]string, ps.n)
+	for i := range list {
+		list[i] = ps.Value(i)
+	}
+	return list
+}
+
+//list returns the values in order, it shares the array of ps when the values fit in it
+func (ps *PathParams) list() []string {
+	if ps.n <= maxParams {
+		return ps.values[:ps.n:ps.n]
+	}
+	return ps.List()
+}
+
+func (ps *PathParams) set(i int, v string) {
+	if i < maxParams {
+		ps.values[i] = v
+		return
+	}
+	for len(ps.more) <= i-maxParams {
+		ps.more = append(ps.more, "")
+	}
+	ps.more[i-maxParams] = v
+}
+
+//clone returns a copy of ps which does not share its storage
+func (ps *PathParams) clone() *PathParams {
+	c := new(PathParams)
+	*c = *ps
+	c.more = append([]string(nil), ps.more...)
+	c.converted = [maxParams]reflect.Value{}
+	return c
+}
+
+//reset clears ps to be reused
+func (ps *PathParams) reset() {
+	for i := 0; i < ps.n && i < maxParams; i++ {
+		ps.values[i] = ""
+	}
+	ps.hostVars, ps.vars, ps.more, ps.n = nil, nil, ps.more[:0], 0
+}
+
+//accepts checks if the params can be converted to the types of the handler params or request struct fields
+func (h *Handler) accepts(ps *PathParams) bool {
+	if h.request != nil {
+		return h.request.accepts(ps)
+	}
+	if h.callT == nil || len(h.paramsT) != ps.Len() {
+		return true
+	}
+	for i, t := range h.paramsT {
+		if t == stringType {
+			continue
+		}
+		if _, err := ps.convert(i, t, h.types); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+//args appends the handler params converted from the params to in, see accepts.
+//The request struct is decoded from the body if WithBody is set, then from the query, form and params of req,
+//see requestParam.decode. The body param is decoded from the body by ctx, see BodyDecoder
+func (h *Handler) args(in []reflect.Value, ctx ContextInterface, req *http.Request, ps *PathParams, strict bool) ([]reflect.Value, error) {
+	if h.request != nil {
+		rv := reflect.New(h.request.typ)
+		if h.body != "" {
+			if err := h.decodeBody(bodyDecoder(ctx, req), rv.Elem()); err != nil {
+				return nil, err
+			}
+		}
+		if err := h.request.decode(req, rv.Elem(), ps, strict); err != nil {
+			return nil, err
+		}
+		return append(in, rv), nil
+	}
+	if len(h.paramsT) != ps.Len() {
+		return in, nil
+	}
+	for i, t := range h.paramsT {
+		rv, _ := ps.convert(i, t, h.types)
+		in = append(in, rv)
+	}
+	if h.bodyT != nil {
+		rv := reflect.New(h.bodyT.Elem())
+		if err := h.decodeBody(bodyDecoder(ctx, req), rv.Elem()); err != nil {
+			return nil, err
+		}
+		in = append(in, rv)
+	}
+	return in, nil
+}
+
+//convert converts the ith value to the type t by strConv. The values of basic kinds are set to the storage of ps
+//instead of allocated, so they are only valid until ps is matched again, exp: the args of a handler call
+func (ps *PathParams) convert(i int, t reflect.Type, types *paramTypes) (reflect.Value, error) {
+	if i >= maxParams || !isBasic(t.Kind()) || types.lookup(t) != nil || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return strConv(ps.Value(i), t, types)
+	}
+	rv := ps.converted[i]
+	if !rv.IsValid() || rv.Type() != t {
+		rv = reflect.New(t).Elem()
+		ps.converted[i] = rv
+	}
+	if err := setBasic(rv, ps.Value(i)); err != nil {
+		return reflect.Value{}, err
+	}
+	return rv, nil
+}
+
+//isBasic checks if the kind is a basic kind which setBasic parses
+func isBasic(k reflect.Kind) bool {
+	return k >= reflect.Bool && k <= reflect.Complex128 || k == reflect.String
+}
+
+//convertible checks if src can be converted to the type t by strConv, the strings are not converted
+func convertible(src string, t reflect.Type, types *paramTypes) bool {
+	if t == stringType {
+		return true
+	}
+	_, err := strConv(src, t, types)
+	return err == nil
+}
@@ -0,0 +1,58 @@
+package ctxrouter
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	stringType   = reflect.TypeOf("")
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+//paramTypes the parsers of the param types registered to a router, see Router.RegisterParamType
+type paramTypes struct {
+	mu sync.Mutex
+	//parsers is replaced on registration, so the requests read it without locking
+	parsers atomic.Pointer[map[reflect.Type]func(string) (reflect.Value, error)]
+}
+
+//RegisterParamType registers the parser of the params of type t, exp: uuid.UUID.
+//It applies to the handler params, request struct fields and their pointers and slices,
+//and to the routes registered before it too. The value returned by parse must be convertible to t
+func (s *Router) RegisterParamType(t reflect.Type, parse func(string) (interface{}, error)) {
+	s.paramTypes.mu.Lock()
+	defer s.paramTypes.mu.Unlock()
+	parsers := make(map[reflect.Type]func(string) (reflect.Value, error))
+	if old := s.paramTypes.parsers.Load(); old != nil {
+		for k, v := range *old {
+			parsers[k] = v
+		}
+	}
+	parsers[t] = func(src string) (reflect.Value, error) {
+		v, err := parse(src)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		rv := reflect.ValueOf(v)
+		if !rv.IsValid() || !rv.Type().ConvertibleTo(t) {
+			return reflect.Value{}, fmt.Errorf("invalid %v param: parsed %T", t, v)
+		}
+		return rv.Convert(t), nil
+	}
+	s.paramTypes.parsers.Store(&parsers)
+}
+
+//lookup returns the parser of type t, it is nil if there is none
+func (p *paramTypes) lookup(t reflect.Type) func(string) (reflect.Value, error) {
+	if p == nil {
+		return nil
+	}
+	if parsers := p.parsers.Load(); parsers != nil {
+		return (*parsers)[t]
+	}
+	return nil
+}
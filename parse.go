@@ -135,15 +135,48 @@ func (p *parser) segment() (segment, error) {
 	if _, err := p.accept("**"); err == nil {
 		return deepWildcard{}, nil
 	}
+	s, err := p.part()
+	if err != nil {
+		return nil, fmt.Errorf("segment neither wildcards, literal or variable: %v", err)
+	}
+	parts := []segment{s}
+	for t := p.tokens[0]; t != "/" && t != "}" && t != eof; t = p.tokens[0] {
+		s, err := p.part()
+		if err != nil {
+			return nil, fmt.Errorf("invalid part of segment %q: %v", parts[0], err)
+		}
+		parts = append(parts, s)
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return newMixed(parts)
+}
+
+// part parses a literal or variable, which may be a part of a mixed segment.
+func (p *parser) part() (segment, error) {
 	if l, err := p.literal(); err == nil {
 		return l, nil
 	}
+	return p.variable()
+}
 
-	v, err := p.variable()
-	if err != nil {
-		return nil, fmt.Errorf("segment neither wildcards, literal or variable: %v", err)
+// newMixed returns the mixed segment of parts.
+// The variables must capture single segments, and the variables and literals must alternate.
+func newMixed(parts []segment) (segment, error) {
+	for i, s := range parts {
+		v, isVar := s.(variable)
+		if isVar && (len(v.segments) != 1 || v.segments[0] != (wildcard{})) {
+			return nil, fmt.Errorf("variable %q in mixed segment must capture a single segment", v.path)
+		}
+		if i == 0 {
+			continue
+		}
+		if _, prevVar := parts[i-1].(variable); prevVar == isVar {
+			return nil, fmt.Errorf("no literal or variable between %q and %q in segment", parts[i-1], s)
+		}
 	}
-	return v, err
+	return mixed(parts), nil
 }
 
 func (p *parser) literal() (segment, error) {
@@ -170,6 +203,11 @@ func (p *parser) variable() (segment, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid segment in variable %q: %v", path, err)
 		}
+		for _, s := range segs {
+			if _, ok := s.(mixed); ok {
+				return nil, fmt.Errorf("invalid segment in variable %q: mixed segment %q", path, s)
+			}
+		}
 	} else {
 		segs = []segment{wildcard{}}
 	}
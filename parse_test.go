@@ -28,6 +28,15 @@ func TestTokenize(t *testing.T) {
 			src:    "v1/endpoint/**",
 			tokens: []string{"v1", "/", "endpoint", "/", "**", eof},
 		},
+		{
+			src: "v{version}/@{user}/{name}.{ext}.gz",
+			tokens: []string{
+				"v", "{", "version", "}", "/",
+				"@", "{", "user", "}", "/",
+				"{", "name", "}", ".", "{", "ext", "}", ".gz",
+				eof,
+			},
+		},
 		{
 			src: "v1/b/{bucket_name=*}",
 			tokens: []string{
@@ -126,6 +135,21 @@ func TestParseSegments(t *testing.T) {
 				wildcard{},
 			},
 		},
+		{
+			tokens: []string{"v", "{", "version", "}", "/", "{", "name", "}", ".", "{", "ext", "=", "*", "}", ".gz", eof},
+			want: []segment{
+				mixed{
+					literal("v"),
+					variable{path: "version", segments: []segment{wildcard{}}},
+				},
+				mixed{
+					variable{path: "name", segments: []segment{wildcard{}}},
+					literal("."),
+					variable{path: "ext", segments: []segment{wildcard{}}},
+					literal(".gz"),
+				},
+			},
+		},
 		{
 			tokens: []string{"v1", "/", "**", eof},
 			want: []segment{
@@ -292,8 +316,16 @@ func TestParseSegmentsWithErrors(t *testing.T) {
 			tokens: []string{"v1", "endpoint", eof},
 		},
 		{
-			// no slash between segments
-			tokens: []string{"v1", "{", "name", "}", eof},
+			// adjacent variables in mixed segment
+			tokens: []string{"{", "name", "}", "{", "ext", "}", eof},
+		},
+		{
+			// multi segment variable in mixed segment
+			tokens: []string{"v", "{", "name", "=", "**", "}", eof},
+		},
+		{
+			// mixed segment in variable
+			tokens: []string{"{", "name", "=", "v", "{", "id", "}", "}", eof},
 		},
 	} {
 		p := parser{tokens: spec.tokens}
@@ -3,6 +3,7 @@ package ctxrouter
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 )
 
@@ -85,6 +86,13 @@ func NewPattern(ops []int, pool []string, verb string) (Pattern, error) {
 				return Pattern{}, ErrInvalidPattern
 			}
 			stack++
+		case OpTrimPrefix, OpTrimSuffix, OpSplit:
+			if op.operand < 0 || len(pool) <= op.operand || stack == 0 {
+				return Pattern{}, ErrInvalidPattern
+			}
+			if op.code == OpSplit {
+				stack++
+			}
 		case OpCapture:
 			if op.operand < 0 || len(pool) <= op.operand {
 				return Pattern{}, ErrInvalidPattern
@@ -127,13 +135,28 @@ func MustPattern(p Pattern, err error) Pattern {
 // If it matches, the function returns a mapping from field paths to their captured values.
 // If otherwise, the function returns an error.
 func (p Pattern) Match(components []string, verb string) (map[string]string, []string, error) {
-	if p.verb != verb {
+	var ps PathParams
+	if !p.match(components, verb, &ps) {
 		return nil, nil, ErrNotMatch
 	}
+	return ps.Map(), ps.List(), nil
+}
+
+// match is Match which captures the values into ps after the variables of host template.
+// It does not allocate unless the stack is deeper than stackBuf, there are more than maxParams values,
+// or the components captured by a multi-segment variable have to be joined.
+func (p Pattern) match(components []string, verb string, ps *PathParams) bool {
+	if p.verb != verb {
+		return false
+	}
 
 	var pos int
-	stack := make([]string, 0, p.stacksize)
-	captured := make([]string, len(p.vars))
+	var stackBuf [8]string
+	stack := stackBuf[:0]
+	if p.stacksize > len(stackBuf) {
+		stack = make([]string, 0, p.stacksize)
+	}
+	base := len(ps.hostVars)
 	l := len(components)
 	for _, op := range p.ops {
 		switch op.code {
@@ -141,12 +164,12 @@ func (p Pattern) Match(components []string, verb string) (map[string]string, []s
 			continue
 		case OpPush, OpLitPush:
 			if pos >= l {
-				return nil, nil, ErrNotMatch
+				return false
 			}
 			c := components[pos]
 			if op.code == OpLitPush {
 				if lit := p.pool[op.operand]; c != lit {
-					return nil, nil, ErrNotMatch
+					return false
 				}
 			}
 			stack = append(stack, c)
@@ -154,7 +177,7 @@ func (p Pattern) Match(components []string, verb string) (map[string]string, []s
 		case OpPushM:
 			end := len(components)
 			if end < pos+p.tailLen {
-				return nil, nil, ErrNotMatch
+				return false
 			}
 			end -= p.tailLen
 			stack = append(stack, strings.Join(components[pos:end], "/"))
@@ -163,23 +186,42 @@ func (p Pattern) Match(components []string, verb string) (map[string]string, []s
 			n := op.operand
 			l := len(stack) - n
 			stack = append(stack[:l], strings.Join(stack[l:], "/"))
+		case OpTrimPrefix:
+			n := len(stack) - 1
+			lit := p.pool[op.operand]
+			if len(stack[n]) <= len(lit) || !strings.HasPrefix(stack[n], lit) {
+				return false
+			}
+			stack[n] = stack[n][len(lit):]
+		case OpTrimSuffix:
+			n := len(stack) - 1
+			lit := p.pool[op.operand]
+			if len(stack[n]) <= len(lit) || !strings.HasSuffix(stack[n], lit) {
+				return false
+			}
+			stack[n] = stack[n][:len(stack[n])-len(lit)]
+		case OpSplit:
+			n := len(stack) - 1
+			c, lit := stack[n], p.pool[op.operand]
+			if c == "" {
+				return false
+			}
+			i := strings.Index(c[1:], lit) + 1
+			if i == 0 || i+len(lit) >= len(c) {
+				return false
+			}
+			stack = append(stack[:n], c[i+len(lit):], c[:i])
 		case OpCapture:
 			n := len(stack) - 1
-			captured[op.operand] = stack[n]
+			ps.set(base+op.operand, stack[n])
 			stack = stack[:n]
 		}
 	}
 	if pos < l {
-		return nil, nil, ErrNotMatch
-	}
-	bindings := make(map[string]string)
-	bindingList := []string{}
-	for i, val := range captured {
-		bindings[p.vars[i]] = val
-		bindingList = append(bindingList, val)
+		return false
 	}
-
-	return bindings, bindingList, nil
+	ps.vars, ps.n = p.vars, base+len(p.vars)
+	return true
 }
 
 // Verb returns the verb part of the Pattern.
@@ -187,57 +229,298 @@ func (p Pattern) Verb() string { return p.verb }
 
 // Reduction reduction the path by path Params
 func (p Pattern) Reduction(pathParams map[string]string) string {
-	var stack []string
+	segs, _ := p.render(func(name, _ string) string {
+		return pathParams[name]
+	})
+	if p.verb != "" {
+		return fmt.Sprintf("/%s:%s", segs, p.verb)
+	}
+	return "/" + segs
+}
+
+// build builds the escaped path of the pattern from the values of its variables.
+// The value of a single segment variable is escaped as one segment, so "/" in it is escaped to %2F.
+// The values of the other variables are escaped segment by segment.
+// It returns an error if a variable is missing, or the value does not match the pattern.
+func (p Pattern) build(params map[string]string) (string, error) {
+	var missing []string
+	segs, wild := p.render(func(name, segments string) string {
+		v, ok := params[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		if segments == "*" {
+			return url.PathEscape(v)
+		}
+		parts := strings.Split(v, "/")
+		for i := range parts {
+			parts[i] = url.PathEscape(parts[i])
+		}
+		return strings.Join(parts, "/")
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing variable %q of %s", missing[0], p)
+	}
+	if wild {
+		return "", fmt.Errorf("wildcard without variable in %s", p)
+	}
+	components, ok := unescapeComponents(strings.Split(segs, "/"))
+	if !ok {
+		return "", fmt.Errorf("variables %v do not match %s", params, p)
+	}
+	if _, _, err := p.Match(components, p.verb); err != nil {
+		return "", fmt.Errorf("variables %v do not match %s", params, p)
+	}
+	if p.verb != "" {
+		return fmt.Sprintf("/%s:%s", segs, p.verb), nil
+	}
+	return "/" + segs, nil
+}
+
+func (p Pattern) String() string {
+	segs, _ := p.render(func(name, segments string) string {
+		return fmt.Sprintf("{%s=%s}", name, segments)
+	})
+	if p.verb != "" {
+		return fmt.Sprintf("/%s:%s", segs, p.verb)
+	}
+	return "/" + segs
+}
+
+// render renders the segments of the pattern, joined by "/".
+// The rendering of each variable is returned by capture, which receives the rendering of the segments it captures.
+// It also reports whether any wildcard is not captured by a variable.
+func (p Pattern) render(capture func(name, segments string) string) (string, bool) {
+	// item is a rendered item of the stack.
+	// The items of mixed segments are rendered as head + value + tail,
+	// and a merged item is rendered into the head of the item under it when it is captured.
+	type item struct {
+		head, value, tail string
+		wild, merge       bool
+	}
+	var stack []item
 	for _, op := range p.ops {
 		switch op.code {
 		case OpNop:
 			continue
 		case OpPush:
-			stack = append(stack, "*")
+			stack = append(stack, item{value: "*", wild: true})
 		case OpLitPush:
-			stack = append(stack, p.pool[op.operand])
+			stack = append(stack, item{value: p.pool[op.operand]})
 		case OpPushM:
-			stack = append(stack, "**")
+			stack = append(stack, item{value: "**", wild: true})
 		case OpConcatN:
 			n := op.operand
 			l := len(stack) - n
-			stack = append(stack[:l], strings.Join(stack[l:], "/"))
+			var concat item
+			var segs []string
+			for _, it := range stack[l:] {
+				segs = append(segs, it.head+it.value+it.tail)
+				concat.wild = concat.wild || it.wild
+			}
+			concat.value = strings.Join(segs, "/")
+			stack = append(stack[:l], concat)
+		case OpTrimPrefix:
+			n := len(stack) - 1
+			stack[n].head += p.pool[op.operand]
+		case OpTrimSuffix:
+			n := len(stack) - 1
+			stack[n].tail = p.pool[op.operand] + stack[n].tail
+		case OpSplit:
+			n := len(stack) - 1
+			it := stack[n]
+			stack = append(stack[:n],
+				item{value: it.value, tail: it.tail, wild: it.wild},
+				item{head: it.head, value: it.value, tail: p.pool[op.operand], wild: it.wild, merge: true})
 		case OpCapture:
 			n := len(stack) - 1
-			stack[n] = pathParams[p.vars[op.operand]]
+			it := stack[n]
+			v := it.head + capture(p.vars[op.operand], it.value) + it.tail
+			if it.merge {
+				stack = stack[:n]
+				stack[n-1].head = v + stack[n-1].head
+			} else {
+				stack[n] = item{value: v}
+			}
 		}
 	}
-	segs := strings.Join(stack, "/")
-	if p.verb != "" {
-		return fmt.Sprintf("/%s:%s", segs, p.verb)
+	var segs []string
+	var wild bool
+	for _, it := range stack {
+		segs = append(segs, it.head+it.value+it.tail)
+		wild = wild || it.wild
 	}
-	return "/" + segs
+	return strings.Join(segs, "/"), wild
 }
 
-func (p Pattern) String() string {
-	var stack []string
-	for _, op := range p.ops {
+// step is an operation of the pattern which consumes a path component.
+type step struct {
+	// code is OpLitPush, OpPush or OpPushM
+	code OpCode
+	// lit is the literal of OpLitPush, or the shape of a mixed segment pushed by OpPush,
+	// in which the variables are replaced by "{}", exp: {}.{}, v{}. It is empty for plain wildcards.
+	lit string
+}
+
+// mixed reports whether the step consumes a mixed segment.
+func (s step) mixed() bool {
+	return s.code == OpPush && s.lit != ""
+}
+
+// rank returns the precedence of a step.
+// Literals are more specific than mixed segments, which are more specific than wildcards,
+// which are more specific than deep wildcards.
+func (s step) rank() int {
+	switch {
+	case s.code == OpLitPush:
+		return 0
+	case s.mixed():
+		return 1
+	case s.code == OpPush:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// literals returns the number of literal bytes in the shape of a mixed segment.
+func (s step) literals() int {
+	return len(s.lit) - 2*strings.Count(s.lit, "{}")
+}
+
+// steps returns the operations of the pattern which consume path components.
+func (p Pattern) steps() []step {
+	var steps []step
+	for i, op := range p.ops {
 		switch op.code {
-		case OpNop:
-			continue
-		case OpPush:
-			stack = append(stack, "*")
 		case OpLitPush:
-			stack = append(stack, p.pool[op.operand])
+			steps = append(steps, step{code: op.code, lit: p.pool[op.operand]})
 		case OpPushM:
-			stack = append(stack, "**")
+			steps = append(steps, step{code: op.code})
+		case OpPush:
+			steps = append(steps, step{code: op.code, lit: p.shape(p.ops[i+1:])})
+		}
+	}
+	return steps
+}
+
+// shape returns the shape of the mixed segment made by the operations after an OpPush, see step.
+// It is empty if the operations do not trim or split the pushed component.
+func (p Pattern) shape(ops []op) string {
+	var prefix, suffix string
+	shape := "{}"
+loop:
+	for _, op := range ops {
+		switch op.code {
+		case OpTrimPrefix:
+			prefix += p.pool[op.operand]
+		case OpTrimSuffix:
+			suffix = p.pool[op.operand] + suffix
+		case OpSplit:
+			shape += p.pool[op.operand] + "{}"
+		case OpCapture:
+		default:
+			break loop
+		}
+	}
+	if shape == "{}" && prefix == "" && suffix == "" {
+		return ""
+	}
+	return prefix + shape + suffix
+}
+
+// equivalent reports whether p and q match exactly the same paths,
+// that is they have the same component consuming operations, literals, shapes of mixed segments and verb.
+func (p Pattern) equivalent(q Pattern) bool {
+	if p.verb != q.verb {
+		return false
+	}
+	ps, qs := p.steps(), q.steps()
+	if len(ps) != len(qs) {
+		return false
+	}
+	for i := range ps {
+		if ps[i] != qs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// multiSegment reports for each variable whether it captures more than one path segment.
+func (p Pattern) multiSegment() []bool {
+	multi := make([]bool, len(p.vars))
+	var stack []bool
+	for _, op := range p.ops {
+		switch op.code {
+		case OpPush, OpLitPush:
+			stack = append(stack, false)
+		case OpPushM:
+			stack = append(stack, true)
+		case OpSplit:
+			stack = append(stack, false)
 		case OpConcatN:
-			n := op.operand
-			l := len(stack) - n
-			stack = append(stack[:l], strings.Join(stack[l:], "/"))
+			l := len(stack) - op.operand
+			m := op.operand > 1
+			for _, b := range stack[l:] {
+				m = m || b
+			}
+			stack = append(stack[:l], m)
 		case OpCapture:
 			n := len(stack) - 1
-			stack[n] = fmt.Sprintf("{%s=%s}", p.vars[op.operand], stack[n])
+			multi[op.operand] = stack[n]
+			stack = stack[:n]
 		}
 	}
-	segs := strings.Join(stack, "/")
-	if p.verb != "" {
-		return fmt.Sprintf("/%s:%s", segs, p.verb)
+	return multi
+}
+
+// trailingSlash reports whether the pattern ends with an empty literal segment, i.e. its template ends with "/".
+func (p Pattern) trailingSlash() bool {
+	steps := p.steps()
+	if len(steps) == 0 {
+		return false
 	}
-	return "/" + segs
+	last := steps[len(steps)-1]
+	return last.code == OpLitPush && last.lit == ""
+}
+
+// emptyTrailingCapture reports whether the path with a trailing slash is matched by p
+// only because the variable of its last segment captures the empty segment, exp: /users/ by /users/{id}.
+func (p Pattern) emptyTrailingCapture(path string) bool {
+	if path == "/" || !strings.HasSuffix(path, "/") {
+		return false
+	}
+	steps := p.steps()
+	return len(steps) > 0 && steps[len(steps)-1].code == OpPush
+}
+
+// precedes reports whether p takes precedence over q when both of them match a path.
+//
+// The steps are compared pairwise and the first step of lower rank wins, so that
+// literals beat mixed segments, mixed segments beat wildcards and wildcards beat
+// deep wildcards regardless of the registration order. Of two mixed segments, the
+// one with more literal bytes wins, exp: {name}.json beats {name}.{ext}.
+// If the steps of one pattern are a prefix of the other ones, the longer
+// pattern wins unless it continues with a deep wildcard which would match
+// nothing. Finally a pattern with a verb precedes a pattern without one.
+func (p Pattern) precedes(q Pattern) bool {
+	ps, qs := p.steps(), q.steps()
+	for i := 0; i < len(ps) && i < len(qs); i++ {
+		if rp, rq := ps[i].rank(), qs[i].rank(); rp != rq {
+			return rp < rq
+		}
+		if ps[i].mixed() {
+			if lp, lq := ps[i].literals(), qs[i].literals(); lp != lq {
+				return lp > lq
+			}
+		}
+	}
+	switch {
+	case len(ps) > len(qs):
+		return ps[len(qs)].code != OpPushM
+	case len(ps) < len(qs):
+		return qs[len(ps)].code == OpPushM
+	}
+	return p.verb != "" && q.verb == ""
 }
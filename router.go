@@ -1,107 +1,579 @@
 package ctxrouter
 
 import (
+	"encoding"
 	"errors"
 	"net/http"
+	"net/url"
+	pathpkg "path"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 //Router the router
 type Router struct {
-	handlers map[string][]Handler
+	//MethodNotAllowed is called when the path matches a route of other methods only,
+	//the Allow header is already set when it is called.
+	//if it is nil, a json error with the Unimplemented code and status 405 is responded
+	MethodNotAllowed http.Handler
+	//NotFound is called when no route matches the request.
+	//if it is nil, a json error with the NotFound code and status 404 is responded
+	NotFound http.Handler
+	//DecodeError is called with the error when the DecodeRequest of the context fails.
+	//if it is nil, the error is responded as json if it is an Error,
+	//otherwise a json error with the InvalidArgument code and status 400 is responded
+	DecodeError func(w http.ResponseWriter, req *http.Request, err error)
+	//HandleHEAD serves HEAD requests by the GET route of the path when there is no HEAD route,
+	//the response body is discarded. It is true by default
+	HandleHEAD bool
+	//HandleOPTIONS answers OPTIONS requests with the Allow header when there is no OPTIONS route.
+	//It is true by default
+	HandleOPTIONS bool
+	//RedirectTrailingSlash redirects to the path with or without the trailing slash
+	//when only that form matches a route. It is true by default
+	RedirectTrailingSlash bool
+	//RedirectFixedPath redirects to the cleaned path (see path.Clean) when it matches a route.
+	//It is true by default
+	RedirectFixedPath bool
+	//RedirectCaseInsensitive also redirects to the path which matches a route
+	//when the literals are compared case-insensitively
+	RedirectCaseInsensitive bool
+	//Strict rejects the routes shadowed by the routes registered before them, see Handle
+	Strict bool
+	//DisallowUnknownQuery rejects the requests whose query or form has keys without field in the request struct,
+	//they are reported as the field violations of the decode error, see Request Structs
+	DisallowUnknownQuery bool
+
+	//mu serializes the updates of routes
+	mu sync.Mutex
+	//state the current routes, it is replaced as a whole by Update and never modified after it is stored
+	state atomic.Pointer[snapshot]
+	//gen the number of updates, see table.gen
+	gen uint64
+	//paramTypes the parsers of param types, see RegisterParamType
+	paramTypes paramTypes
 }
 
 //Handle handler path in router
-func (s *Router) Handle(method, path string, v interface{}) error {
-	path = adapterRouterStyle(path)
-	pattern, err := ParsePatternURL(path)
+//it returns an error if the route matches exactly the same paths as a route registered before,
+//unless any of them has matchers, see Router.Strict and WithMatcher.
+//It is safe to call Handle while the router is serving requests, see Update
+func (s *Router) Handle(method, path string, v interface{}, opts ...RouteOption) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.Handle(method, path, v, opts...)
+	})
+}
+
+//newHandler parses the path and inspects the handler of a route, the params are converted with the parsers of types
+func newHandler(path string, v interface{}, opts []RouteOption, types *paramTypes) (*Handler, error) {
+	pattern, constraints, err := parseTemplate(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	val := Handler{
-		V:     v,
-		Pat:   pattern,
-		callV: reflect.ValueOf(v),
-	}
-	if reflect.TypeOf(v).Kind() == reflect.Func {
-		switch val.callV.Interface().(type) {
-		case http.HandlerFunc, func(http.ResponseWriter, *http.Request):
-			//do noting
-		default:
-			val.callT = reflect.TypeOf(v).In(0).Elem()
-			paramsLen := val.callV.Type().NumIn()
-			val.hasParams = paramsLen > 1
-			for i := 0; i < paramsLen; i++ {
-				if i == 1 {
-					val.paramsT = make([]reflect.Type, 0)
-					val.paramsT = append(val.paramsT, val.callV.Type().In(i))
-				} else if i > 1 {
-					val.paramsT = append(val.paramsT, val.callV.Type().In(i))
-				}
+		V:           v,
+		Pat:         pattern,
+		callV:       reflect.ValueOf(v),
+		template:    path,
+		constraints: constraints,
+		types:       types,
+	}
+	switch h := v.(type) {
+	case http.Handler:
+		val.handler = h
+	case func(http.ResponseWriter, *http.Request):
+		val.handler = http.HandlerFunc(h)
+	case typedHandler:
+		val.typed = h
+		val.callT = h.contextType()
+		val.paramsT = []reflect.Type{h.requestType()}
+	default:
+		if v == nil || reflect.TypeOf(v).Kind() != reflect.Func {
+			return nil, errors.New("invalid handler type, it must be a func or http.Handler")
+		}
+		val.callT = reflect.TypeOf(v).In(0).Elem()
+		paramsLen := val.callV.Type().NumIn()
+		val.hasParams = paramsLen > 1
+		for i := 0; i < paramsLen; i++ {
+			if i == 1 {
+				val.paramsT = make([]reflect.Type, 0)
+				val.paramsT = append(val.paramsT, val.callV.Type().In(i))
+			} else if i > 1 {
+				val.paramsT = append(val.paramsT, val.callV.Type().In(i))
 			}
 		}
 	}
-	if method == "" {
-		method = "*"
+	for _, opt := range opts {
+		opt(&val)
+	}
+	if n := len(val.paramsT); val.typed == nil && n > 1 && val.numVars() == n-1 && isBodyType(val.paramsT[n-1], types) {
+		val.bodyT, val.paramsT = val.paramsT[n-1], val.paramsT[:n-1]
 	}
-	s.handlers[method] = append(s.handlers[method], val)
-	return nil
+	if len(val.paramsT) == 1 {
+		if val.request = newRequestParam(val.paramsT[0], types); val.request != nil {
+			if err := val.request.resolve(&val); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if val.typed != nil && val.request == nil {
+		return nil, errors.New("invalid request type of typed handler, it must be a struct")
+	}
+	if err := val.resolveBody(); err != nil {
+		return nil, err
+	}
+	if val.callT != nil && val.request == nil && val.bodyT == nil {
+		val.invoker = lookupInvoker(val.callV)
+	}
+	return &val, nil
 }
 
-// Match dispatches the request to the first handler whose pattern matches to r.Method and r.Path.
+//numVars returns the number of the variables of the host template and path template
+func (h *Handler) numVars() int {
+	n := len(h.Pat.vars)
+	if h.host != "" {
+		if pat, err := ParsePatternURL(hostPath(h.host)); err == nil {
+			n += len(pat.vars)
+		}
+	}
+	return n
+}
+
+// Match dispatches the request to the most specific handler whose pattern matches to r.Method and r.Path.
+// Handlers registered for the method are tried before the handlers registered for all methods ("*").
+// Only the routes without host template are matched, see MatchHost.
+// The path is escaped (see url.URL.EscapedPath), an escaped "/" does not separate segments,
+// and the captured values are unescaped, except the escaped "/" captured by multi-segment variables.
 func (s *Router) Match(method string, path string) (h Handler, pathParams map[string]string, paramsList []string, err error) {
-	components := strings.Split(path[1:], "/")
-	l := len(components)
-	var verb string
-	if idx := strings.LastIndex(components[l-1], ":"); idx > 0 {
-		c := components[l-1]
-		components[l-1], verb = c[:idx], c[idx+1:]
+	return s.MatchHost(method, "", path)
+}
+
+// MatchHost is Match of the routes whose host template matches host, the port of host is ignored.
+// The variables of host template are bound before the variables of path.
+// The routes without host template are matched when no route of the matching host templates matches.
+// The matchers of routes are not evaluated, see MatchRequest.
+func (s *Router) MatchHost(method, host, path string) (h Handler, pathParams map[string]string, paramsList []string, err error) {
+	return s.matchValue(nil, method, host, path)
+}
+
+// MatchRequest is MatchHost of the method, host and path of request.
+// The routes whose matchers reject the request are skipped, see WithMatcher.
+func (s *Router) MatchRequest(req *http.Request) (h Handler, pathParams map[string]string, paramsList []string, err error) {
+	return s.matchValue(req, req.Method, req.Host, req.URL.EscapedPath())
+}
+
+// MatchParams is MatchHost which captures the params into ps instead of building a map and a list of them,
+// ps is reset before matching. It does not allocate for the routes with few single segment variables, see PathParams.
+func (s *Router) MatchParams(method, host, path string, ps *PathParams) (h Handler, err error) {
+	ps.reset()
+	val, err := s.match(nil, method, host, path, ps)
+	if err != nil {
+		return Handler{}, err
+	}
+	return *val, nil
+}
+
+//matchValue is match which returns the copy of the handler and the map and list of params
+func (s *Router) matchValue(req *http.Request, method, host, path string) (Handler, map[string]string, []string, error) {
+	var ps PathParams
+	h, err := s.match(req, method, host, path, &ps)
+	if err != nil {
+		return Handler{}, nil, nil, err
+	}
+	return *h, ps.Map(), ps.List(), nil
+}
+
+//match finds the handler of method, host and path, and captures the params into ps.
+//the matchers of routes are evaluated if req is not nil
+func (s *Router) match(req *http.Request, method, host, path string, ps *PathParams) (*Handler, error) {
+	var buf [16]string
+	components, ok := splitPath(buf[:0], path)
+	if !ok {
+		return nil, ErrNotMatch
+	}
+	var h *Handler
+	s.load().tables(host, ps, func(t *table) bool {
+		if h = t.match(req, method, components, ps); h == nil {
+			h = t.match(req, "*", components, ps)
+		}
+		return h != nil
+	})
+	if h == nil {
+		return nil, ErrNotMatch
+	}
+	return h, nil
+}
+
+//allowed returns the sorted methods which can serve the host and path of request,
+//including the methods handled automatically by HandleHEAD and HandleOPTIONS
+func (s *Router) allowed(req *http.Request) (methods []string) {
+	components, ok := splitPath(nil, req.URL.EscapedPath())
+	if !ok {
+		return nil
+	}
+	set := make(map[string]bool)
+	var ps PathParams
+	s.load().tables(req.Host, &ps, func(t *table) bool {
+		for method := range t.trees {
+			if method == "*" {
+				continue
+			}
+			h := t.match(req, method, components, &ps)
+			if h == nil {
+				continue
+			}
+			set[method] = true
+			if method == "GET" && s.HandleHEAD && !h.noAutoHead {
+				set["HEAD"] = true
+			}
+			if s.HandleOPTIONS && !h.noAutoOptions {
+				set["OPTIONS"] = true
+			}
+		}
+		return len(set) > 0
+	})
+	for method := range set {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+//redirect returns the canonical path to redirect the request to, if any.
+//The paths which start with "//" are never redirected to, they are protocol-relative urls of other hosts
+func (s *Router) redirect(req *http.Request) (string, bool) {
+	p, ok := s.canonical(req)
+	if !ok || strings.HasPrefix(p, "//") {
+		return "", false
+	}
+	return p, true
+}
+
+//canonical returns the cleaned, trailing slash toggled or case folded path which a route serves, see redirect
+func (s *Router) canonical(req *http.Request) (string, bool) {
+	method, path := req.Method, req.URL.EscapedPath()
+	if s.RedirectFixedPath {
+		if clean := cleanPath(path); clean != path {
+			if s.served(req, method, clean) {
+				return clean, true
+			}
+			path = clean
+			if p := toggleSlash(path); s.RedirectTrailingSlash && s.served(req, method, p) {
+				return p, true
+			}
+		}
+	}
+	if p := toggleSlash(path); s.RedirectTrailingSlash && p != path && s.served(req, method, p) {
+		return p, true
+	}
+	if s.RedirectFixedPath && s.RedirectCaseInsensitive {
+		if p, ok := s.fold(req, method, path); ok {
+			return p, true
+		}
+		if p := toggleSlash(path); s.RedirectTrailingSlash && p != path {
+			return s.fold(req, method, p)
+		}
+	}
+	return "", false
+}
+
+//served checks if a route serves the method and path, including the automatic HEAD routes.
+//A path with a trailing slash is only served by the templates which end with a slash too,
+//not by the variables which capture the empty last segment
+func (s *Router) served(req *http.Request, method, path string) bool {
+	var ps PathParams
+	h, err := s.match(req, method, req.Host, path, &ps)
+	if err != nil && method == "HEAD" && s.HandleHEAD {
+		h, err = s.match(req, "GET", req.Host, path, &ps)
+		if err == nil && h.noAutoHead {
+			err = ErrNotMatch
+		}
 	}
-	h, pathParams, paramsList, err = match(s.handlers[method], components, verb)
 	if err != nil {
-		return match(s.handlers["*"], components, verb)
+		return false
+	}
+	return path == "/" || !strings.HasSuffix(path, "/") || h.Pat.trailingSlash()
+}
+
+//fold finds the path which matches a route when the literals are compared case-insensitively
+func (s *Router) fold(req *http.Request, method, path string) (fixed string, ok bool) {
+	raw := strings.Split(path[1:], "/")
+	l := len(raw)
+	var verb string
+	if idx := strings.LastIndex(raw[l-1], ":"); idx > 0 {
+		raw[l-1], verb = raw[l-1][:idx], raw[l-1][idx:]
+	}
+	components, valid := unescapeComponents(raw)
+	if !valid {
+		return
 	}
+	methods := []string{method, "*"}
+	if method == "HEAD" && s.HandleHEAD {
+		methods = append(methods, "GET")
+	}
+	var ps PathParams
+	s.load().tables(req.Host, &ps, func(t *table) bool {
+		for _, m := range methods {
+			root, found := t.trees[m]
+			if !found {
+				continue
+			}
+			root.fold(components, make([]string, 0, l), func(c []string) bool {
+				//the literals replaced by fold are escaped, the other components keep their escapes
+				escaped := make([]string, len(c))
+				for i := range c {
+					if c[i] == components[i] {
+						escaped[i] = raw[i]
+					} else {
+						escaped[i] = url.PathEscape(c[i])
+					}
+				}
+				p := "/" + strings.Join(escaped, "/") + verb
+				if p != path && s.served(req, method, p) {
+					fixed, ok = p, true
+				}
+				return ok
+			})
+			if ok {
+				return true
+			}
+		}
+		return false
+	})
 	return
 }
 
-func match(handlers []Handler, components []string, verb string) (h Handler, pathParams map[string]string, paramsList []string, err error) {
-	for _, handler := range handlers {
-		pathParams, p, err := handler.Pat.Match(components, verb)
-		if err != nil {
+//cleanPath is path.Clean which keeps the trailing slash
+func cleanPath(p string) string {
+	clean := pathpkg.Clean(p)
+	if clean != "/" && strings.HasSuffix(p, "/") {
+		clean += "/"
+	}
+	return clean
+}
+
+//splitPath appends the components of the escaped path to dst, see unescapeComponents.
+//It does not allocate unless dst is too small or a component is escaped
+func splitPath(dst []string, path string) ([]string, bool) {
+	path = path[1:]
+	for {
+		idx := strings.IndexByte(path, '/')
+		if idx < 0 {
+			break
+		}
+		dst = append(dst, path[:idx])
+		path = path[idx+1:]
+	}
+	return unescapeComponents(append(dst, path))
+}
+
+//unescapeComponents decodes the escaped path components in place, except "%2F" and "%25",
+//so that an escaped "/" is matched inside a component instead of separating components.
+//The values captured from the components are decoded by unescapeCapture.
+//It returns false if any component is not escaped correctly
+func unescapeComponents(components []string) ([]string, bool) {
+	for i, c := range components {
+		if strings.IndexByte(c, '%') < 0 {
 			continue
 		}
-		if handler.V != nil && handler.callT != nil && p != nil && len(p) == len(handler.paramsT) {
-			handler.paramsV = make([]reflect.Value, 0)
-			for i, n := range p {
-				pt := handler.paramsT[i]
-				pv, err := strConv(n, pt)
-				if err == nil {
-					handler.paramsV = append(handler.paramsV, pv)
-				} else {
-					return handler, pathParams, p, ErrNotMatch
-				}
+		var b strings.Builder
+		for j := 0; j < len(c); j++ {
+			if c[j] != '%' {
+				b.WriteByte(c[j])
+				continue
+			}
+			if j+2 >= len(c) {
+				return nil, false
+			}
+			v, err := strconv.ParseUint(c[j+1:j+3], 16, 8)
+			if err != nil {
+				return nil, false
 			}
+			if v == '/' || v == '%' {
+				b.WriteString(strings.ToUpper(c[j : j+3]))
+			} else {
+				b.WriteByte(byte(v))
+			}
+			j += 2
 		}
-		return handler, pathParams, p, nil
+		components[i] = b.String()
 	}
-	err = ErrNotMatch
-	return
+	return components, true
+}
+
+//unescapeCapture decodes the value captured from the components decoded by unescapeComponents.
+//As google.api.http defines, the value of a variable which captures multiple segments keeps "%2F",
+//the value of a single segment variable is fully decoded
+func unescapeCapture(v string, multiSegment bool) string {
+	if strings.IndexByte(v, '%') < 0 {
+		return v
+	}
+	if multiSegment {
+		return strings.Replace(v, "%25", "%", -1)
+	}
+	v, _ = url.PathUnescape(v)
+	return v
+}
+
+//setBasic parses src into rv of a basic kind, time.Duration included, see strConv
+func setBasic(rv reflect.Value, src string) (err error) {
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(src)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Type() == durationType {
+			var d time.Duration
+			if d, err = time.ParseDuration(src); err == nil {
+				rv.SetInt(int64(d))
+			}
+			break
+		}
+		var v int64
+		if v, err = strconv.ParseInt(src, 10, rv.Type().Bits()); err == nil {
+			rv.SetInt(v)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var v uint64
+		if v, err = strconv.ParseUint(src, 10, rv.Type().Bits()); err == nil {
+			rv.SetUint(v)
+		}
+	case reflect.Float32, reflect.Float64:
+		var v float64
+		if v, err = strconv.ParseFloat(src, rv.Type().Bits()); err == nil {
+			rv.SetFloat(v)
+		}
+	case reflect.Complex64, reflect.Complex128:
+		var v complex128
+		if v, err = strconv.ParseComplex(src, rv.Type().Bits()); err == nil {
+			rv.SetComplex(v)
+		}
+	case reflect.Bool:
+		var v bool
+		if v, err = strconv.ParseBool(src); err == nil {
+			rv.SetBool(v)
+		}
+	default:
+		err = errors.New("elem of invalid type")
+	}
+	return err
+}
+
+//slashUnescaper decodes the escaped "/" which unescapeCapture keeps in the values of multi-segment variables
+var slashUnescaper = strings.NewReplacer("%2F", "/", "%2f", "/")
+
+//toggleSlash adds or removes the trailing slash of the path
+func toggleSlash(p string) string {
+	if p == "/" {
+		return p
+	}
+	if strings.HasSuffix(p, "/") {
+		return p[:len(p)-1]
+	}
+	return p + "/"
 }
 
 //Handler the handler instance in router
 type Handler struct {
 	Pat Pattern
 	V   interface{}
+	//Name the name of route, see WithName
+	Name string
+	//Meta the metadata of route, see WithMeta
+	Meta map[string]interface{}
 
 	//some values for reflect call
 	callV   reflect.Value
 	callT   reflect.Type
-	paramsV []reflect.Value
 	paramsT []reflect.Type
 	//faster when callback
 	hasParams bool
+	//handler is set when V is a http.Handler or func(http.ResponseWriter, *http.Request)
+	handler http.Handler
+	//route options
+	noAutoHead    bool
+	noAutoOptions bool
+	middleware    []Middleware
+	host          string
+	matchers      []Matcher
+	//template the original path template
+	template string
+	//constraints the constraints of variables, indexed by field path
+	constraints map[string]constraint
+	//request binds the variables into the fields of the request struct param, see requestParam
+	request *requestParam
+	//invoker calls the handler without reflection if it is generated, see RegisterInvoker
+	invoker *Invoker
+	//typed is set when the handler is registered by the generic Handle
+	typed typedHandler
+	//types the parsers of param types registered to the router
+	types *paramTypes
+	//bodyT the type of body param, the last handler param which is decoded from the request body
+	bodyT reflect.Type
+	//body the field path which the request body is decoded into, "*" is the whole, see WithBody
+	body string
+	//bodyField the field of body, it is nil when the body is decoded into the whole
+	bodyField *field
+}
+
+//Middleware wraps the handler of a route
+type Middleware func(http.Handler) http.Handler
+
+//RouteOption configures a route when it is registered
+type RouteOption func(*Handler)
+
+//WithName names the route, so that its path can be built by Router.URL
+func WithName(name string) RouteOption {
+	return func(h *Handler) {
+		h.Name = name
+	}
+}
+
+//WithMiddleware wraps the route by the middleware, the first one is the outermost
+func WithMiddleware(middleware ...Middleware) RouteOption {
+	return func(h *Handler) {
+		h.middleware = append(h.middleware[:len(h.middleware):len(h.middleware)], middleware...)
+	}
+}
+
+//WithBody selects where the request body is decoded into, like the body of google.api.http.
+//"*" is the whole body param or request struct, other values are the field paths in them, exp: "book".
+//The body of typed handlers, body params and request structs is "*" by default on every method,
+//the empty bodies are not decoded
+func WithBody(field string) RouteOption {
+	return func(h *Handler) {
+		h.body = field
+	}
+}
+
+//WithMeta sets the metadata of the route, it can be read by Meta(req) when the route is served
+func WithMeta(key string, value interface{}) RouteOption {
+	return func(h *Handler) {
+		meta := make(map[string]interface{}, len(h.Meta)+1)
+		for k, v := range h.Meta {
+			meta[k] = v
+		}
+		meta[key] = value
+		h.Meta = meta
+	}
+}
+
+//AutoHead enables or disables serving HEAD requests by this GET route, see Router.HandleHEAD
+func AutoHead(enabled bool) RouteOption {
+	return func(h *Handler) {
+		h.noAutoHead = !enabled
+	}
+}
+
+//AutoOptions enables or disables answering OPTIONS requests for this route, see Router.HandleOPTIONS
+func AutoOptions(enabled bool) RouteOption {
+	return func(h *Handler) {
+		h.noAutoOptions = !enabled
+	}
 }
 
 //adapterRouterStyle change /v1/home/:id/name style to /v1/home/{id}/name style
@@ -109,8 +581,20 @@ type Handler struct {
 // Deprecated: use /v1/home/{id}/name style
 func adapterRouterStyle(src string) string {
 	var prefix bool
+	//depth of braces, the google style variables are kept as is
+	var depth int
 	for i := 0; i < len(src); i++ {
 		v := src[i]
+		switch {
+		case prefix:
+		case v == '{':
+			depth++
+		case v == '}':
+			depth--
+		}
+		if depth > 0 {
+			continue
+		}
 		if prefix && v == '/' {
 			src = src[0:i] + "}" + src[i:]
 			prefix = false
@@ -136,6 +620,16 @@ func adapterRouterStyle(src string) string {
 	return src
 }
 
+//parseTemplate parses the path template of route, which may have the constraints of variables, see parseConstraints
+func parseTemplate(path string) (Pattern, map[string]constraint, error) {
+	path, constraints, err := parseConstraints(path)
+	if err != nil {
+		return Pattern{}, nil, err
+	}
+	pattern, err := ParsePatternURL(adapterRouterStyle(path))
+	return pattern, constraints, err
+}
+
 //ParsePatternURL parse any path to google pattern
 func ParsePatternURL(path string) (pattern Pattern, err error) {
 	cp, err := Parse(path)
@@ -147,55 +641,49 @@ func ParsePatternURL(path string) (pattern Pattern, err error) {
 	return
 }
 
-//strConv convert string params to function params
-func strConv(src string, t reflect.Type) (rv reflect.Value, err error) {
+//strConv convert string params to function params of type t, the parsers of types registered to the router are tried first.
+//Every basic kind, time.Duration, encoding.TextUnmarshaler and the pointers to them are supported.
+//The elements of a slice are the segments of src split by "/", exp: the value captured by **
+func strConv(src string, t reflect.Type, types *paramTypes) (rv reflect.Value, err error) {
+	if parse := types.lookup(t); parse != nil {
+		return parse(src)
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		rv = reflect.New(t)
+		if err = rv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(src)); err != nil {
+			return reflect.Value{}, err
+		}
+		return rv.Elem(), nil
+	}
 	switch t.Kind() {
-	case reflect.String:
-		rv = reflect.ValueOf(src)
-	case reflect.Int:
-		v, err := strconv.Atoi(src)
-		noErrorFunc(err, func() {
-			rv = reflect.ValueOf(v)
-		})
-	case reflect.Int64:
-		v, err := strconv.ParseInt(src, 10, 64)
-		noErrorFunc(err, func() {
-			rv = reflect.ValueOf(v)
-		})
-	case reflect.Bool:
-		v, err := strconv.ParseBool(src)
-		noErrorFunc(err, func() {
-			rv = reflect.ValueOf(v)
-		})
-	case reflect.Float64:
-		v, err := strconv.ParseFloat(src, 64)
-		noErrorFunc(err, func() {
-			rv = reflect.ValueOf(v)
-		})
-	case reflect.Float32:
-		v, err := strconv.ParseFloat(src, 32)
-		noErrorFunc(err, func() {
-			rv = reflect.ValueOf(float32(v))
-		})
-	case reflect.Uint64:
-		v, err := strconv.ParseUint(src, 10, 64)
-		noErrorFunc(err, func() {
-			rv = reflect.ValueOf(v)
-		})
-	case reflect.Uint32:
-		v, err := strconv.ParseUint(src, 10, 32)
-		noErrorFunc(err, func() {
-			rv = reflect.ValueOf(uint32(v))
-		})
+	case reflect.Ptr:
+		var ev reflect.Value
+		if ev, err = strConv(src, t.Elem(), types); err == nil {
+			rv = reflect.New(t.Elem())
+			rv.Elem().Set(ev)
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			rv = reflect.New(t).Elem()
+			rv.SetBytes([]byte(src))
+			break
+		}
+		//the segments are split by "/", the escaped "/" kept by unescapeCapture belongs to a segment
+		parts := strings.Split(src, "/")
+		rv = reflect.MakeSlice(t, len(parts), len(parts))
+		for i, part := range parts {
+			var ev reflect.Value
+			if ev, err = strConv(slashUnescaper.Replace(part), t.Elem(), types); err != nil {
+				break
+			}
+			rv.Index(i).Set(ev)
+		}
 	default:
-		err = errors.New("elem of invalid type")
+		rv = reflect.New(t).Elem()
+		err = setBasic(rv, src)
 	}
-	return rv, err
-}
-
-func noErrorFunc(err error, fn func()) {
 	if err != nil {
-		return
+		return reflect.Value{}, errors.New("invalid " + t.String() + " param: " + src)
 	}
-	fn()
+	return rv, nil
 }
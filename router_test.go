@@ -1 +1,1707 @@
 package ctxrouter
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ti/ctxrouter/errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func noopHandler(w http.ResponseWriter, r *http.Request) {}
+
+type testContext struct {
+	Context
+}
+
+func (c *testContext) Item(project string, id int) {
+	c.Text(project + "/" + strconv.Itoa(id))
+}
+
+type bookRequest struct {
+	Tenant  string
+	Project string `path:"project_id"`
+	Book    struct {
+		Shelf *struct {
+			Name string `json:"name,omitempty"`
+		} `protobuf:"bytes,1,opt,name=shelf,proto3"`
+		ID int64 `json:"id"`
+	} `json:"book"`
+}
+
+func (c *testContext) GetBook(req *bookRequest) {
+	var shelf string
+	if req.Book.Shelf != nil {
+		shelf = req.Book.Shelf.Name
+	}
+	c.Text(fmt.Sprintf("%s/%s/%s/%d", req.Tenant, req.Project, shelf, req.Book.ID))
+}
+
+func (c *testContext) Shelf(name string, id int) (interface{}, error) {
+	if id == 0 {
+		return nil, errors.CodeError(errors.InvalidArgument).WithDescription("invalid id")
+	}
+	return map[string]interface{}{"name": name, "id": id}, nil
+}
+
+type testLevel int
+
+//testUUID is a uuid-like type decoded by UnmarshalText
+type testUUID [16]byte
+
+func (u *testUUID) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(strings.Replace(string(text), "-", "", -1))
+	if err != nil || len(b) != len(u) {
+		return fmt.Errorf("invalid uuid %q", text)
+	}
+	copy(u[:], b)
+	return nil
+}
+
+//testColor is a custom param type registered by RegisterParamType
+type testColor struct {
+	R, G, B uint8
+}
+
+func (c *testContext) Types(a int32, b uint, d time.Duration, l testLevel, id testUUID, color *testColor, path []string) {
+	c.Text(fmt.Sprintf("%d %d %v %d %x %v %q", a, b, d, l, id[:2], *color, path))
+}
+
+func (c *testContext) Paint(color *testColor) {
+	c.Text(fmt.Sprintf("%v", *color))
+}
+
+type eventRequest struct {
+	At    time.Time `json:"at"`
+	Tags  []string  `json:"tags"`
+	Color testColor `json:"color"`
+}
+
+func (c *testContext) Event(req *eventRequest) {
+	c.Text(fmt.Sprintf("%s %q %v", req.At.Format(time.RFC3339), req.Tags, req.Color))
+}
+
+func TestRouterMatch(t *testing.T) {
+	r := New()
+	for _, spec := range []struct {
+		method, path string
+	}{
+		{"GET", "/"},
+		{"GET", "/v1/users"},
+		{"GET", "/v1/users/"},
+		{"GET", "/v1/users/{id}"},
+		{"GET", "/v1/users/{id}:activate"},
+		{"GET", "/v1/users/{id}/books/{book.name}"},
+		{"GET", "/v1/files/{path=**}"},
+		{"GET", "/v1/files/{path=**}/edit"},
+		{"POST", "/v1/users"},
+		{"*", "/v1/any/{name}"},
+	} {
+		if err := r.Handle(spec.method, spec.path, noopHandler); err != nil {
+			t.Fatalf("r.Handle(%q, %q) failed with %v; want success", spec.method, spec.path, err)
+		}
+	}
+	for _, spec := range []struct {
+		method, path string
+		want         string
+		params       []string
+	}{
+		{method: "GET", path: "/", want: "/"},
+		{method: "GET", path: "/v1/users", want: "/v1/users", params: []string{}},
+		{method: "GET", path: "/v1/users/", want: "/v1/users/", params: []string{}},
+		{method: "POST", path: "/v1/users", want: "/v1/users", params: []string{}},
+		{method: "GET", path: "/v1/users/42", want: "/v1/users/{id=*}", params: []string{"42"}},
+		{method: "GET", path: "/v1/users/42:activate", want: "/v1/users/{id=*}:activate", params: []string{"42"}},
+		{method: "GET", path: "/v1/users/42/books/7", want: "/v1/users/{id=*}/books/{book.name=*}", params: []string{"42", "7"}},
+		{method: "GET", path: "/v1/files/a/b/c", want: "/v1/files/{path=**}", params: []string{"a/b/c"}},
+		{method: "GET", path: "/v1/files/a/b/edit", want: "/v1/files/{path=**}/edit", params: []string{"a/b"}},
+		{method: "DELETE", path: "/v1/any/x", want: "/v1/any/{name=*}", params: []string{"x"}},
+		{method: "GET", path: "/v1/users/42/books"},
+		{method: "DELETE", path: "/v1/users"},
+		{method: "GET", path: "/v2"},
+	} {
+		h, _, params, err := r.Match(spec.method, spec.path)
+		if spec.want == "" {
+			if err == nil {
+				t.Errorf("r.Match(%q, %q) = %q; want ErrNotMatch", spec.method, spec.path, h.Pat)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("r.Match(%q, %q) failed with %v; want success", spec.method, spec.path, err)
+			continue
+		}
+		if got := h.Pat.String(); got != spec.want {
+			t.Errorf("r.Match(%q, %q) = %q; want %q", spec.method, spec.path, got, spec.want)
+		}
+		if spec.params != nil && !reflect.DeepEqual(params, spec.params) {
+			t.Errorf("r.Match(%q, %q) params = %q; want %q", spec.method, spec.path, params, spec.params)
+		}
+	}
+}
+
+func TestRouterMatchPrecedence(t *testing.T) {
+	for _, spec := range []struct {
+		templates []string
+		path      string
+		want      string
+	}{
+		{
+			templates: []string{"/users/{id}", "/users/me"},
+			path:      "/users/me",
+			want:      "/users/me",
+		},
+		{
+			templates: []string{"/users/{id}", "/users/me"},
+			path:      "/users/you",
+			want:      "/users/{id=*}",
+		},
+		{
+			templates: []string{"/a/{path=**}", "/a/{id}", "/a/b"},
+			path:      "/a/b",
+			want:      "/a/b",
+		},
+		{
+			templates: []string{"/a/{path=**}", "/a/{id}"},
+			path:      "/a/c",
+			want:      "/a/{id=*}",
+		},
+		{
+			templates: []string{"/a/{path=**}", "/a"},
+			path:      "/a",
+			want:      "/a",
+		},
+		{
+			templates: []string{"/a/{path=**}", "/a/{rest=**}/edit"},
+			path:      "/a/b/edit",
+			want:      "/a/{rest=**}/edit",
+		},
+		{
+			templates: []string{"/{x}/b/{y}", "/a/{y}/{z}"},
+			path:      "/a/b/c",
+			want:      "/a/{y=*}/{z=*}",
+		},
+		{
+			templates: []string{"/files/{name}", "/files/{name}:download"},
+			path:      "/files/f1:download",
+			want:      "/files/{name=*}:download",
+		},
+		{
+			templates: []string{"/files/{name}", "/files/{name}:download"},
+			path:      "/files/f1:other",
+			want:      "/files/{name=*}",
+		},
+	} {
+		for _, templates := range [][]string{spec.templates, reversed(spec.templates)} {
+			r := New()
+			for _, tmpl := range templates {
+				r.Get(tmpl, noopHandler)
+			}
+			h, _, _, err := r.Match("GET", spec.path)
+			if err != nil {
+				t.Errorf("r.Match(%q) failed with %v; want success; templates=%q", spec.path, err, templates)
+				continue
+			}
+			if got := h.Pat.String(); got != spec.want {
+				t.Errorf("r.Match(%q) = %q; want %q; templates=%q", spec.path, got, spec.want, templates)
+			}
+		}
+	}
+}
+
+func reversed(s []string) []string {
+	r := make([]string, len(s))
+	for i, v := range s {
+		r[len(s)-1-i] = v
+	}
+	return r
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	r := New()
+	r.Get("/users/{id}", noopHandler)
+	r.Delete("/users/{id}", noopHandler)
+	r.Post("/users", noopHandler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/users/42", nil))
+	if got, want := w.Code, http.StatusMethodNotAllowed; got != want {
+		t.Errorf("w.Code = %d; want %d", got, want)
+	}
+	if got, want := w.Header().Get("Allow"), "DELETE, GET, HEAD, OPTIONS"; got != want {
+		t.Errorf("w.Header().Get(%q) = %q; want %q", "Allow", got, want)
+	}
+	if got, want := w.Body.String(), `{"error":"unimplemented","error_description":"method PUT not allowed"}`; got != want {
+		t.Errorf("w.Body = %s; want %s", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/groups/42", nil))
+	if got, want := w.Code, http.StatusNotFound; got != want {
+		t.Errorf("w.Code = %d; want %d", got, want)
+	}
+
+	r.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	if got, want := w.Code, http.StatusTeapot; got != want {
+		t.Errorf("w.Code = %d; want %d", got, want)
+	}
+	if got, want := w.Header().Get("Allow"), "OPTIONS, POST"; got != want {
+		t.Errorf("w.Header().Get(%q) = %q; want %q", "Allow", got, want)
+	}
+}
+
+type decodeContext struct {
+	Context
+}
+
+//statuslessError an Error without status code
+type statuslessError struct {
+	Message string `json:"error"`
+}
+
+func (e *statuslessError) StatusCode() int { return 0 }
+func (e *statuslessError) Error() string   { return e.Message }
+func (e *statuslessError) IsNil() bool     { return e == nil }
+
+func (c *decodeContext) DecodeRequest() error {
+	if c.Request.URL.Query().Get("denied") != "" {
+		return errors.New(errors.PermissionDenied, "denied")
+	}
+	if c.Request.URL.Query().Get("statusless") != "" {
+		return &statuslessError{Message: "statusless"}
+	}
+	return fmt.Errorf("bad body")
+}
+
+func (c *decodeContext) Create() {}
+
+func TestRouterErrorHandlers(t *testing.T) {
+	r := New()
+	r.Post("/users", (*decodeContext).Create)
+
+	for _, spec := range []struct {
+		path, body string
+		code       int
+	}{
+		{"/groups", `{"error":"not_found","error_description":"path /groups not found"}`, http.StatusNotFound},
+		{"/users", `{"error":"invalid_argument","error_description":"bad body"}`, http.StatusBadRequest},
+		{"/users?denied=1", `{"error":"denied"}`, http.StatusForbidden},
+		{"/users?statusless=1", `{"error":"statusless"}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", spec.path, nil))
+		if w.Code != spec.code || w.Body.String() != spec.body {
+			t.Errorf("POST %s: w.Code, w.Body = %d, %s; want %d, %s", spec.path, w.Code, w.Body.String(), spec.code, spec.body)
+		}
+	}
+
+	r.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	r.DecodeError = func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	for _, spec := range []struct {
+		path string
+		code int
+	}{
+		{"/groups", http.StatusTeapot},
+		{"/users", http.StatusUnprocessableEntity},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", spec.path, nil))
+		if w.Code != spec.code {
+			t.Errorf("POST %s: w.Code = %d; want %d", spec.path, w.Code, spec.code)
+		}
+	}
+}
+
+func TestRouterAutoHeadOptions(t *testing.T) {
+	r := New()
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-User", Params(r)[0])
+		w.Write([]byte("user"))
+	})
+	r.Put("/users/{id}", noopHandler, AutoOptions(false))
+	r.Get("/files/{id}", noopHandler, AutoHead(false), AutoOptions(false))
+	r.Options("/groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	r.Get("/groups/{id}", noopHandler)
+
+	for _, spec := range []struct {
+		method, path string
+		code         int
+		allow        string
+	}{
+		{method: "HEAD", path: "/users/42", code: http.StatusOK},
+		{method: "OPTIONS", path: "/users/42", code: http.StatusNoContent, allow: "GET, HEAD, OPTIONS, PUT"},
+		{method: "HEAD", path: "/files/42", code: http.StatusMethodNotAllowed, allow: "GET"},
+		{method: "OPTIONS", path: "/files/42", code: http.StatusMethodNotAllowed, allow: "GET"},
+		{method: "OPTIONS", path: "/groups/42", code: http.StatusTeapot},
+		{method: "OPTIONS", path: "/unknown", code: http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(spec.method, spec.path, nil))
+		if got, want := w.Code, spec.code; got != want {
+			t.Errorf("%s %s: w.Code = %d; want %d", spec.method, spec.path, got, want)
+		}
+		if got, want := w.Header().Get("Allow"), spec.allow; got != want {
+			t.Errorf("%s %s: Allow = %q; want %q", spec.method, spec.path, got, want)
+		}
+		if spec.method == "HEAD" && w.Body.Len() != 0 {
+			t.Errorf("%s %s: w.Body = %q; want empty", spec.method, spec.path, w.Body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("HEAD", "/users/42", nil))
+	if got, want := w.Header().Get("X-User"), "42"; got != want {
+		t.Errorf("X-User = %q; want %q", got, want)
+	}
+}
+
+func TestRouterRedirect(t *testing.T) {
+	r := New()
+	r.Get("/users", noopHandler)
+	r.Post("/users", noopHandler)
+	r.Get("/groups/", noopHandler)
+	r.Get("/Users/{id}/Books", noopHandler)
+
+	for _, spec := range []struct {
+		method, path    string
+		caseInsensitive bool
+		code            int
+		location        string
+	}{
+		{method: "GET", path: "/users/", code: http.StatusMovedPermanently, location: "/users"},
+		{method: "HEAD", path: "/users/", code: http.StatusMovedPermanently, location: "/users"},
+		{method: "POST", path: "/users/?a=b", code: http.StatusPermanentRedirect, location: "/users?a=b"},
+		{method: "GET", path: "/groups", code: http.StatusMovedPermanently, location: "/groups/"},
+		{method: "GET", path: "/a/../users", code: http.StatusMovedPermanently, location: "/users"},
+		{method: "GET", path: "//groups", code: http.StatusMovedPermanently, location: "/groups/"},
+		{method: "GET", path: "/users/42/books", code: http.StatusNotFound},
+		{method: "GET", path: "/users/42/books", caseInsensitive: true, code: http.StatusMovedPermanently, location: "/Users/42/Books"},
+		{method: "GET", path: "/USERS/", caseInsensitive: true, code: http.StatusMovedPermanently, location: "/users"},
+		{method: "DELETE", path: "/users", code: http.StatusMethodNotAllowed},
+		{method: "DELETE", path: "/users/", code: http.StatusNotFound},
+	} {
+		r.RedirectCaseInsensitive = spec.caseInsensitive
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(spec.method, spec.path, nil))
+		if got, want := w.Code, spec.code; got != want {
+			t.Errorf("%s %s: w.Code = %d; want %d", spec.method, spec.path, got, want)
+		}
+		if got, want := w.Header().Get("Location"), spec.location; got != want {
+			t.Errorf("%s %s: Location = %q; want %q", spec.method, spec.path, got, want)
+		}
+	}
+}
+
+func TestRouterRedirectEmptyCapture(t *testing.T) {
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%q", Params(r))
+	}
+	r := New()
+	r.Get("/users", echo)
+	r.Get("/users/{id}", echo)
+	r.Get("/books/{id}", echo)
+	for _, spec := range []struct {
+		path     string
+		code     int
+		location string
+		body     string
+	}{
+		{path: "/users/", code: http.StatusMovedPermanently, location: "/users"},
+		{path: "/users/42", code: http.StatusOK, body: `["42"]`},
+		//there is no /books, so the empty capture is served
+		{path: "/books/", code: http.StatusOK, body: `[""]`},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", spec.path, nil))
+		if w.Code != spec.code {
+			t.Errorf("GET %s: w.Code = %d; want %d", spec.path, w.Code, spec.code)
+		}
+		if got := w.Header().Get("Location"); got != spec.location {
+			t.Errorf("GET %s: Location = %q; want %q", spec.path, got, spec.location)
+		}
+		if got := w.Body.String(); spec.body != "" && got != spec.body {
+			t.Errorf("GET %s: w.Body = %q; want %q", spec.path, got, spec.body)
+		}
+	}
+	r.RedirectTrailingSlash = false
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /users/ without RedirectTrailingSlash: w.Code = %d; want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRouterRedirectProtocolRelative(t *testing.T) {
+	r := New()
+	r.Get("/{a}/{b}", noopHandler)
+	for _, fixed := range []bool{false, true} {
+		r.RedirectFixedPath = fixed
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "//evil.com/", nil))
+		if got := w.Header().Get("Location"); strings.HasPrefix(got, "//") {
+			t.Errorf("GET //evil.com/ with RedirectFixedPath = %v: Location = %q; want no protocol-relative url", fixed, got)
+		}
+	}
+}
+
+func TestRouterGroup(t *testing.T) {
+	var trace []string
+	middleware := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	r := New()
+	v1 := r.Group("/v1/").Use(middleware("v1")).Meta("scope", "read")
+	projects := v1.Group("/projects/{project}").Use(middleware("projects"))
+	projects.Get("/items/{id}", (*testContext).Item, WithMiddleware(middleware("route")))
+	projects.Post("/items", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(Params(r), Meta(r))))
+	}, WithMeta("scope", "write"))
+	v1.Get("", noopHandler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/projects/p1/items/42", nil))
+	if got, want := w.Body.String(), "p1/42"; got != want {
+		t.Errorf("w.Body = %q; want %q", got, want)
+	}
+	if got, want := trace, []string{"v1", "projects", "route"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("trace = %q; want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/v1/projects/p1/items", nil))
+	if got, want := w.Body.String(), "[p1] map[scope:write]"; got != want {
+		t.Errorf("w.Body = %q; want %q", got, want)
+	}
+
+	if _, _, _, err := r.Match("GET", "/v1"); err != nil {
+		t.Errorf("r.Match(%q, %q) failed with %v; want success", "GET", "/v1", err)
+	}
+}
+
+func TestRouterMount(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s %q", r.URL.Path, r.URL.RawPath, Params(r))
+	})
+	sub := New()
+	sub.Get("/items/{id}", echo)
+	sub.Get("/", echo)
+
+	r := New()
+	r.Mount("/static/", echo)
+	r.Mount("/v1/tenants/{tenant}", sub)
+	r.Group("/v2/{version}").Mount("/files", echo)
+	r.Get("/teapot", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for _, spec := range []struct {
+		method, path string
+		want         string
+	}{
+		{method: "GET", path: "/static/css/a.css", want: `/css/a.css  []`},
+		{method: "POST", path: "/static", want: `/  []`},
+		{method: "GET", path: "/static/a%2Fb/c", want: `/a/b/c /a%2Fb/c []`},
+		{method: "GET", path: "/v1/tenants/t1/items/42", want: `/items/42  ["t1" "42"]`},
+		{method: "GET", path: "/v1/tenants/t1/", want: `/  ["t1"]`},
+		{method: "GET", path: "/v2/beta/files/a/b", want: `/a/b  ["beta"]`},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(spec.method, spec.path, nil))
+		if got := w.Body.String(); got != spec.want {
+			t.Errorf("%s %s: w.Body = %q; want %q", spec.method, spec.path, got, spec.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/teapot", nil))
+	if got, want := w.Code, http.StatusTeapot; got != want {
+		t.Errorf("w.Code = %d; want %d", got, want)
+	}
+	if err := r.Handle("GET", "/invalid", "handler"); err == nil {
+		t.Errorf("r.Handle(%q, %q, %q) succeeded; want error", "GET", "/invalid", "handler")
+	}
+
+	//the redirects of the mounted router keep the prefix
+	tenants := New()
+	tenants.Get("/items", echo)
+	shelves := New()
+	shelves.Get("/books", echo)
+	tenants.Mount("/shelves/{shelf}", shelves)
+	r.Mount("/v3/tenants/{tenant}", tenants)
+	for _, spec := range []struct {
+		path, location string
+	}{
+		{path: "/v3/tenants/t1/items/", location: "/v3/tenants/t1/items"},
+		{path: "/v3/tenants/t1/shelves/s1/books/?a=b", location: "/v3/tenants/t1/shelves/s1/books?a=b"},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", spec.path, nil))
+		if got, want := w.Code, http.StatusMovedPermanently; got != want {
+			t.Errorf("GET %s: w.Code = %d; want %d", spec.path, got, want)
+		}
+		if got := w.Header().Get("Location"); got != spec.location {
+			t.Errorf("GET %s: Location = %q; want %q", spec.path, got, spec.location)
+		}
+	}
+}
+
+func TestRouterHost(t *testing.T) {
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %q", name, Params(r))
+		}
+	}
+	r := New()
+	r.Host("{tenant}.api.Example.com").Get("/items/{id}", echo("tenant"))
+	r.Host("admin.api.example.com").Get("/items/{id}", echo("admin"))
+	r.Host("{sub=**}.example.org").Get("/", echo("org"))
+	r.Get("/items/{id}", echo("default"))
+	r.Get("/health", echo("health"))
+	r.Host("{tenant}.api.example.com").Get("/projects/{project}", (*testContext).Item)
+
+	for _, spec := range []struct {
+		host, path string
+		want       string
+	}{
+		{host: "acme.api.example.com", path: "/items/42", want: `tenant ["acme" "42"]`},
+		{host: "ACME.api.example.com:8080", path: "/items/42", want: `tenant ["acme" "42"]`},
+		{host: "admin.api.example.com", path: "/items/42", want: `admin ["42"]`},
+		{host: "a.b.example.org", path: "/", want: `org ["a.b"]`},
+		{host: "example.com", path: "/items/42", want: `default ["42"]`},
+		{host: "acme.api.example.com", path: "/health", want: `health []`},
+		{host: "acme.api.example.com", path: "/projects/7", want: `acme/7`},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", spec.path, nil)
+		req.Host = spec.host
+		r.ServeHTTP(w, req)
+		if got := w.Body.String(); got != spec.want {
+			t.Errorf("%s%s: w.Body = %q; want %q", spec.host, spec.path, got, spec.want)
+		}
+	}
+
+	_, pathParams, _, err := r.MatchHost("GET", "acme.api.example.com", "/items/42")
+	if err != nil {
+		t.Fatalf("r.MatchHost failed with %v; want success", err)
+	}
+	if got, want := pathParams, map[string]string{"tenant": "acme", "id": "42"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pathParams = %v; want %v", got, want)
+	}
+}
+
+func TestRouterMatchers(t *testing.T) {
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}
+	}
+	r := New()
+	r.Get("/files/{name}", echo("media"), WithMatcher(MatchQuery("alt", "media")))
+	r.Get("/files/{name}", echo("v2"), WithMatcher(MatchAcceptParam("version", "2")))
+	r.Get("/files/{id}", echo("default"))
+	r.Post("/files", echo("json"), WithMatcher(MatchContentType("application/json")))
+	r.Post("/files", echo("upload"), WithMatcher(MatchHeader("X-Upload-Content-Type", "")))
+
+	for _, spec := range []struct {
+		method, path string
+		header       http.Header
+		code         int
+		want         string
+	}{
+		{method: "GET", path: "/files/a?alt=media", code: 200, want: "media"},
+		{method: "GET", path: "/files/a?alt=json", code: 200, want: "default"},
+		{method: "GET", path: "/files/a", header: http.Header{"Accept": {"text/html, application/json; version=2"}}, code: 200, want: "v2"},
+		{method: "POST", path: "/files", header: http.Header{"Content-Type": {"application/json; charset=utf-8"}}, code: 200, want: "json"},
+		{method: "POST", path: "/files", header: http.Header{"X-Upload-Content-Type": {"image/png"}}, code: 200, want: "upload"},
+		{method: "POST", path: "/files", code: http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(spec.method, spec.path, nil)
+		for k, v := range spec.header {
+			req.Header[k] = v
+		}
+		r.ServeHTTP(w, req)
+		if got, want := w.Code, spec.code; got != want {
+			t.Errorf("%s %s: w.Code = %d; want %d", spec.method, spec.path, got, want)
+		}
+		if got := w.Body.String(); spec.want != "" && got != spec.want {
+			t.Errorf("%s %s: w.Body = %q; want %q", spec.method, spec.path, got, spec.want)
+		}
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	r := New()
+	r.Get("/v1/users/{id}", noopHandler, WithName("user"))
+	r.Get("/v1/{name=shelves/*}/books/{book}:read", noopHandler, WithName("book"))
+	r.Get("/v1/files/{path=**}/edit", noopHandler, WithName("file"))
+	r.Get("/v1/projects", noopHandler, WithName("projects"))
+	r.Group("/v2/{version}").Get("/items", noopHandler, WithName("items"))
+	if err := r.Handle("GET", "/v1/users", noopHandler, WithName("user")); err == nil {
+		t.Errorf("r.Handle with a duplicate name succeeded; want error")
+	}
+
+	for _, spec := range []struct {
+		name  string
+		pairs []string
+		query url.Values
+		want  string
+	}{
+		{name: "user", pairs: []string{"id", "42"}, want: "/v1/users/42"},
+		{name: "user", pairs: []string{"id", "a/b c"}, want: "/v1/users/a%2Fb%20c"},
+		{name: "book", pairs: []string{"name", "shelves/1", "book", "2"}, want: "/v1/shelves/1/books/2:read"},
+		{name: "file", pairs: []string{"path", "a b/c"}, want: "/v1/files/a%20b/c/edit"},
+		{name: "projects", query: url.Values{"page": {"2"}}, want: "/v1/projects?page=2"},
+		{name: "items", pairs: []string{"version", "beta"}, want: "/v2/beta/items"},
+		{name: "user"},
+		{name: "user", pairs: []string{"id"}},
+		{name: "user", pairs: []string{"id", "42", "other", "1"}},
+		{name: "book", pairs: []string{"name", "racks/1", "book", "2"}},
+		{name: "unknown"},
+	} {
+		got, err := r.URLQuery(spec.name, spec.query, spec.pairs...)
+		if spec.want == "" {
+			if err == nil {
+				t.Errorf("r.URLQuery(%q, %v, %q) = %q; want error", spec.name, spec.query, spec.pairs, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("r.URLQuery(%q, %v, %q) failed with %v; want success", spec.name, spec.query, spec.pairs, err)
+			continue
+		}
+		if got != spec.want {
+			t.Errorf("r.URLQuery(%q, %v, %q) = %q; want %q", spec.name, spec.query, spec.pairs, got, spec.want)
+		}
+	}
+}
+
+func TestRouterConflict(t *testing.T) {
+	matcher := WithMatcher(MatchQuery("alt", "media"))
+	for _, spec := range []struct {
+		first, second  string
+		opts1, opts2   []RouteOption
+		strict, errors bool
+	}{
+		{first: "/users/{id}", second: "/users/{id}", errors: true},
+		{first: "/users/{id}", second: "/users/:id", errors: true},
+		{first: "/users/{id}", second: "/users/{name}", errors: true},
+		{first: "/files/{path=**}", second: "/files/{name=**}", errors: true},
+		{first: "/{name=users/*}", second: "/users/{id}", errors: true},
+		{first: "/users/{id}:get", second: "/users/{id}:get", errors: true},
+		{first: "/users/{id}", second: "/users/{id}:get"},
+		{first: "/users/{id}", second: "/users/me"},
+		{first: "/files/{path=**}", second: "/files/{path=**}/edit"},
+		{first: "/users/{id}", second: "/users/{id}", opts1: []RouteOption{matcher}},
+		{first: "/users/{id}", second: "/users/{id}", opts2: []RouteOption{matcher}},
+		{first: "/users/{id}", second: "/users/{id}", opts2: []RouteOption{matcher}, strict: true, errors: true},
+		{first: "/users/{id}", second: "/users/{id}", opts1: []RouteOption{matcher}, strict: true},
+		{first: "/users/{id}", second: "/users/{id}", opts2: []RouteOption{WithHost("api.example.com")}},
+	} {
+		r := New()
+		r.Strict = spec.strict
+		if err := r.Handle("GET", spec.first, noopHandler, spec.opts1...); err != nil {
+			t.Errorf("r.Handle(%q) failed with %v; want success", spec.first, err)
+			continue
+		}
+		err := r.Handle("GET", spec.second, noopHandler, spec.opts2...)
+		if spec.errors && err == nil {
+			t.Errorf("r.Handle(%q) after %q succeeded; want error; strict=%v", spec.second, spec.first, spec.strict)
+		}
+		if !spec.errors && err != nil {
+			t.Errorf("r.Handle(%q) after %q failed with %v; want success; strict=%v", spec.second, spec.first, err, spec.strict)
+		}
+	}
+}
+
+func TestRouterRoutes(t *testing.T) {
+	r := New()
+	r.Get("/v1/files/{path=**}", noopHandler)
+	r.Get("/v1/projects/{project}/items/{id}", (*testContext).Item, WithName("item"))
+	r.Get("/v1/projects/{project}/items/new", noopHandler)
+	r.Post("/v1/users/:id", noopHandler)
+	r.All("/v1/users/{id}:watch", noopHandler)
+	r.Get("/v1/users/{id}", noopHandler, WithHost("{tenant}.example.com"))
+	r.Post("/v1/shelves/{shelf}/books/{id}", (*testContext).CreateBook, WithName("create"))
+
+	var got []string
+	for _, route := range r.Routes() {
+		got = append(got, route.Host+" "+route.Method+" "+route.Template)
+	}
+	want := []string{
+		"{tenant}.example.com GET /v1/users/{id}",
+		" GET /v1/files/{path=**}",
+		" GET /v1/projects/{project}/items/new",
+		" GET /v1/projects/{project}/items/{id}",
+		" POST /v1/shelves/{shelf}/books/{id}",
+		" POST /v1/users/:id",
+		" * /v1/users/{id}:watch",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("r.Routes() = %q; want %q", got, want)
+	}
+
+	var item, create RouteInfo
+	r.Walk(func(route RouteInfo) error {
+		switch route.Name {
+		case "item":
+			item = route
+		case "create":
+			create = route
+		}
+		return nil
+	})
+	if want := []string{"project", "id"}; !reflect.DeepEqual(item.Vars, want) {
+		t.Errorf("item.Vars = %q; want %q", item.Vars, want)
+	}
+	if want := reflect.TypeOf(testContext{}); item.Context != want {
+		t.Errorf("item.Context = %v; want %v", item.Context, want)
+	}
+	if want := []reflect.Type{reflect.TypeOf(""), reflect.TypeOf(0)}; !reflect.DeepEqual(item.Params, want) {
+		t.Errorf("item.Params = %v; want %v", item.Params, want)
+	}
+	//the body param is listed with the other params
+	if want := []reflect.Type{reflect.TypeOf(""), reflect.TypeOf(0), reflect.TypeOf(&createBookRequest{})}; !reflect.DeepEqual(create.Params, want) {
+		t.Errorf("create.Params = %v; want %v", create.Params, want)
+	}
+	if want := "github.com/ti/ctxrouter.(*testContext).Item-fm"; item.Handler != want && item.Handler != "github.com/ti/ctxrouter.(*testContext).Item" {
+		t.Errorf("item.Handler = %q; want %q", item.Handler, want)
+	}
+
+	stop := fmt.Errorf("stop")
+	var n int
+	if err := r.Walk(func(route RouteInfo) error {
+		n++
+		return stop
+	}); err != stop || n != 1 {
+		t.Errorf("r.Walk stopped with %v after %d routes; want %v after 1 route", err, n, stop)
+	}
+}
+
+func TestRouterUpdate(t *testing.T) {
+	r := New()
+	r.Get("/v1/users/{id}", (*testContext).Item, WithName("user"))
+	r.Get("/v1/users/me", noopHandler)
+	r.Get("/v1/plugins/{name}", noopHandler, WithHost("api.example.com"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			r.Match("GET", "/v1/users/"+strconv.Itoa(i))
+			r.Routes()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := r.Replace("GET", "/v1/users/:id", noopHandler, WithName("user")); err != nil {
+			t.Fatalf("r.Replace failed with %v; want success", err)
+		}
+	}
+	<-done
+
+	if h, _, _, err := r.Match("GET", "/v1/users/1"); err != nil || h.handler == nil {
+		t.Errorf("r.Match(%q) = %v, %v; want the replaced route", "/v1/users/1", h.V, err)
+	}
+	if err := r.Remove("GET", "/v1/users/{name}"); err == nil {
+		t.Errorf("r.Remove(%q) succeeded; want error", "/v1/users/{name}")
+	}
+	if err := r.Remove("GET", "/v1/plugins/{name}"); err == nil {
+		t.Errorf("r.Remove(%q) without host succeeded; want error", "/v1/plugins/{name}")
+	}
+	if err := r.Remove("GET", "/v1/plugins/{name}", WithHost("api.example.com")); err != nil {
+		t.Errorf("r.Remove(%q) failed with %v; want success", "/v1/plugins/{name}", err)
+	}
+	if err := r.Remove("GET", "/v1/users/{id}"); err != nil {
+		t.Errorf("r.Remove(%q) failed with %v; want success", "/v1/users/{id}", err)
+	}
+	if _, _, _, err := r.Match("GET", "/v1/users/1"); err != ErrNotMatch {
+		t.Errorf("r.Match(%q) after r.Remove failed with %v; want %v", "/v1/users/1", err, ErrNotMatch)
+	}
+	if _, err := r.URL("user", "id", "1"); err == nil {
+		t.Errorf("r.URL(%q) of a removed route succeeded; want error", "user")
+	}
+
+	err := r.Update(func(tx *Tx) error {
+		if err := tx.Handle("GET", "/v1/items/{id}", noopHandler); err != nil {
+			return err
+		}
+		return tx.Remove("GET", "/v1/users/me")
+	})
+	if err != nil {
+		t.Errorf("r.Update failed with %v; want success", err)
+	}
+	err = r.Update(func(tx *Tx) error {
+		if err := tx.Handle("GET", "/v1/projects", noopHandler); err != nil {
+			return err
+		}
+		return tx.Handle("GET", "/v1/items/{name}", noopHandler)
+	})
+	if err == nil {
+		t.Errorf("r.Update with an ambiguous route succeeded; want error")
+	}
+	var got []string
+	for _, route := range r.Routes() {
+		got = append(got, route.Template)
+	}
+	if want := []string{"/v1/items/{id}"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("r.Routes() = %q; want %q", got, want)
+	}
+}
+
+func TestRouterUpdateSnapshots(t *testing.T) {
+	templates := func(s *snapshot) (got []string) {
+		s.routes.walk("", func(route RouteInfo) error {
+			got = append(got, route.Template)
+			return nil
+		})
+		return got
+	}
+	r := New()
+	r.Get("/v1/users/{id}", noopHandler)
+	r.Get("/v1/users/{id}.{ext}", noopHandler)
+	r.Get("/v1/files/{path=**}", noopHandler)
+	before := r.load()
+	want := templates(before)
+	r.Get("/v1/users/{id}/books", noopHandler)
+	r.Get("/v1/users/{id}.json", noopHandler)
+	r.Get("/v1/files/{path=**}:get", noopHandler)
+	for _, path := range []string{"/v1/users/{id}", "/v1/users/{id}.{ext}", "/v1/files/{path=**}"} {
+		if err := r.Remove("GET", path); err != nil {
+			t.Errorf("r.Remove(%q) failed with %v; want success", path, err)
+		}
+	}
+	//the trees are copied on write, so the routes served before the updates are not changed
+	if got := templates(before); !reflect.DeepEqual(got, want) {
+		t.Errorf("templates of the snapshot before updates = %q; want %q", got, want)
+	}
+	if got, want := templates(r.load()), []string{"/v1/files/{path=**}:get", "/v1/users/{id}.json", "/v1/users/{id}/books"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("templates after updates = %q; want %q", got, want)
+	}
+
+	//the nodes and host tables without routes are pruned when the routes are removed
+	r = New()
+	r.Get("/v1/users", noopHandler)
+	nodes := countNodes(r.load().routes.trees["GET"])
+	for i := 0; i < 3; i++ {
+		err := r.Update(func(tx *Tx) error {
+			for _, path := range []string{"/v1/plugins/p" + strconv.Itoa(i) + "/{id}/items", "/v1/plugins/{name}.{ext}", "/v1/files/{path=**}"} {
+				if err := tx.Handle("GET", path, noopHandler); err != nil {
+					return err
+				}
+			}
+			return tx.Handle("GET", "/v1/hosts", noopHandler, WithHost("{tenant}.example.com"))
+		})
+		if err != nil {
+			t.Fatalf("r.Update failed with %v; want success", err)
+		}
+		err = r.Update(func(tx *Tx) error {
+			for _, path := range []string{"/v1/plugins/p" + strconv.Itoa(i) + "/{id}/items", "/v1/plugins/{name}.{ext}", "/v1/files/{path=**}"} {
+				if err := tx.Remove("GET", path); err != nil {
+					return err
+				}
+			}
+			return tx.Remove("GET", "/v1/hosts", WithHost("{tenant}.example.com"))
+		})
+		if err != nil {
+			t.Fatalf("r.Update failed with %v; want success", err)
+		}
+	}
+	snap := r.load()
+	if got := countNodes(snap.routes.trees["GET"]); got != nodes {
+		t.Errorf("nodes after removing the plugins = %d; want %d", got, nodes)
+	}
+	if len(snap.hosts) != 0 {
+		t.Errorf("len(hosts) after removing the host routes = %d; want 0", len(snap.hosts))
+	}
+	if err := r.Remove("GET", "/v1/users"); err != nil {
+		t.Fatalf("r.Remove failed with %v; want success", err)
+	}
+	if _, ok := r.load().routes.trees["GET"]; ok {
+		t.Errorf("tree of GET after removing all routes exists; want none")
+	}
+}
+
+//countNodes returns the number of nodes of the tree
+func countNodes(n *node) int {
+	if n == nil {
+		return 0
+	}
+	count := 1 + countNodes(n.wildcard)
+	for _, child := range n.static {
+		count += countNodes(child)
+	}
+	for _, m := range n.mixed {
+		count += countNodes(m.node)
+	}
+	return count
+}
+
+func BenchmarkRouterHandle(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		r := New()
+		for j := 0; j < 400; j++ {
+			r.Get("/v1/resource"+strconv.Itoa(j)+"/{id}", noopHandler)
+		}
+	}
+}
+
+func TestRouterEscapedPath(t *testing.T) {
+	r := New()
+	params := func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "%s %q", req.URL.Path, Params(req))
+	}
+	r.Get("/v1/users/me", params)
+	r.Get("/v1/users/{id}", params)
+	r.Get("/v1/files/{path=**}", params)
+	r.Mount("/v1/tenants/{tenant}", http.HandlerFunc(params))
+
+	for _, spec := range []struct {
+		path, want string
+	}{
+		{"/v1/users/a%2Fb", `/v1/users/a/b ["a/b"]`},
+		{"/v1/users/a%2fb", `/v1/users/a/b ["a/b"]`},
+		{"/v1/users/a%20b", `/v1/users/a b ["a b"]`},
+		{"/v1/users/%252F", `/v1/users/%2F ["%2F"]`},
+		{"/v1/us%65rs/m%65", `/v1/users/me []`},
+		{"/v1/files/a%2Fb/c%20d", `/v1/files/a/b/c d ["a%2Fb/c d"]`},
+		{"/v1/files/100%25/a", `/v1/files/100%/a ["100%/a"]`},
+		{"/v1/tenants/a%2Fb/items/1", `/items/1 ["a/b"]`},
+	} {
+		req := httptest.NewRequest("GET", spec.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Body.String(); got != spec.want {
+			t.Errorf("GET %s: w.Body = %q; want %q", spec.path, got, spec.want)
+		}
+	}
+	if _, _, _, err := r.Match("GET", "/v1/users/a%zz"); err != ErrNotMatch {
+		t.Errorf("r.Match(%q) failed with %v; want %v", "/v1/users/a%zz", err, ErrNotMatch)
+	}
+}
+
+func TestRouterConstraints(t *testing.T) {
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}
+	}
+	r := New()
+	r.Get("/items/{slug}", echo("slug"))
+	r.Get("/items/{id:int}", echo("int"), WithName("item"))
+	r.Get("/items/{id:uuid}", echo("uuid"))
+	r.Get("/items/{code:[a-z]{2}}", echo("code"))
+	r.Get("/v1/projects/{project}/items/{name}", echo("name"))
+	r.Get("/v1/projects/{project}/items/{id}", (*testContext).Item)
+
+	for _, spec := range []struct {
+		path, want string
+	}{
+		{"/items/42", "int"},
+		{"/items/123e4567-e89b-12d3-a456-426614174000", "uuid"},
+		{"/items/ab", "code"},
+		{"/items/abc", "slug"},
+		{"/v1/projects/p/items/7", "p/7"},
+		{"/v1/projects/p/items/x", "name"},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", spec.path, nil))
+		if got := w.Body.String(); got != spec.want {
+			t.Errorf("GET %s: w.Body = %q; want %q", spec.path, got, spec.want)
+		}
+	}
+
+	for _, path := range []string{"/items/{id:int}", "/items/{id:[}", "/items/{id:int"} {
+		if err := r.Handle("GET", path, noopHandler); err == nil {
+			t.Errorf("r.Handle(%q) succeeded; want error", path)
+		}
+	}
+	if _, err := r.URL("item", "id", "abc"); err == nil {
+		t.Errorf("r.URL(%q, %q, %q) succeeded; want error", "item", "id", "abc")
+	}
+	if err := r.Remove("GET", "/items/{id:int}"); err != nil {
+		t.Errorf("r.Remove(%q) failed with %v; want success", "/items/{id:int}", err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/items/42", nil))
+	if got, want := w.Body.String(), "slug"; got != want {
+		t.Errorf("GET /items/42 after r.Remove: w.Body = %q; want %q", got, want)
+	}
+}
+
+func TestRouterMixedSegments(t *testing.T) {
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %q", name, Params(r))
+		}
+	}
+	r := New()
+	r.Get("/files/{name}", echo("name"))
+	r.Get("/files/{name}.{ext}", echo("ext"), WithName("file"))
+	r.Get("/files/{name}.json", echo("json"))
+	r.Get("/files/readme.json", echo("literal"))
+	r.Get("/v{version:int}/items", echo("items"))
+	r.Get("/@{user}", echo("user"))
+
+	for _, spec := range []struct {
+		path, want string
+	}{
+		{"/files/a.json", `json ["a"]`},
+		{"/files/a.tar.gz", `ext ["a" "tar.gz"]`},
+		{"/files/a", `name ["a"]`},
+		{"/files/.json", `name [".json"]`},
+		{"/files/readme.json", `literal []`},
+		{"/files/a%2Eb.c", `ext ["a" "b.c"]`},
+		{"/v2/items", `items ["2"]`},
+		{"/v/items", `404`},
+		{"/vx/items", `404`},
+		{"/@bob", `user ["bob"]`},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", spec.path, nil))
+		got := w.Body.String()
+		if w.Code == http.StatusNotFound {
+			got = "404"
+		}
+		if got != spec.want {
+			t.Errorf("GET %s: w.Body = %q; want %q", spec.path, got, spec.want)
+		}
+	}
+
+	if err := r.Handle("GET", "/files/{id}.{type}", noopHandler); err == nil {
+		t.Errorf("r.Handle(%q) succeeded; want error", "/files/{id}.{type}")
+	}
+	if got, err := r.URL("file", "name", "a b", "ext", "txt"); err != nil || got != "/files/a%20b.txt" {
+		t.Errorf("r.URL(%q) = %q, %v; want %q", "file", got, err, "/files/a%20b.txt")
+	}
+	if got, err := r.URL("file", "name", "a", "ext", ""); err == nil {
+		t.Errorf("r.URL(%q) with an empty variable = %q; want error", "file", got)
+	}
+	for _, tmpl := range []string{"/v{version}/{name}.{ext}.gz:get", "/@{user}/files/{path=**}"} {
+		p, err := ParsePatternURL(tmpl)
+		if err != nil {
+			t.Errorf("ParsePatternURL(%q) failed with %v; want success", tmpl, err)
+			continue
+		}
+		q, err := ParsePatternURL(p.String())
+		if err != nil || q.String() != p.String() {
+			t.Errorf("ParsePatternURL(%q) = %v, %v; want %v", p.String(), q, err, p)
+		}
+		params := map[string]string{"version": "1", "name": "a", "ext": "tar", "user": "bob", "path": "x/y"}
+		if got, want := p.Reduction(params), strings.NewReplacer("{version}", "1", "{name}", "a", "{ext}", "tar", "{user}", "bob", "{path=**}", "x/y").Replace(tmpl); got != want {
+			t.Errorf("%v.Reduction(%v) = %q; want %q", p, params, got, want)
+		}
+	}
+}
+
+func TestRouterRequestParam(t *testing.T) {
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}
+	}
+	r := New()
+	r.Get("/v1/projects/{project_id}/{book.shelf.name=shelves/*}/books/{book.id}", (*testContext).GetBook)
+	r.Get("/v1/projects/{project}/{shelf=shelves/*}/books/{name}", echo("name"))
+	r.Host("{tenant}.example.com").Get("/v2/{project_id}/books/{book.id}:get", (*testContext).GetBook)
+	for _, path := range []string{"/v1/{book.title}", "/v1/{book.shelf.name.first}"} {
+		if err := r.Handle("GET", path, (*testContext).GetBook); err == nil {
+			t.Errorf("r.Handle(%q) succeeded; want error", path)
+		}
+	}
+
+	for _, spec := range []struct {
+		host, path, want string
+	}{
+		{"", "/v1/projects/p1/shelves/s1/books/42", "/p1/shelves/s1/42"},
+		{"", "/v1/projects/p1/shelves/s1/books/abc", "name"},
+		{"t1.example.com", "/v2/p1/books/42:get", "t1/p1//42"},
+	} {
+		req := httptest.NewRequest("GET", spec.path, nil)
+		if spec.host != "" {
+			req.Host = spec.host
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Body.String(); got != spec.want {
+			t.Errorf("GET %s%s: w.Body = %q; want %q", spec.host, spec.path, got, spec.want)
+		}
+	}
+}
+
+func BenchmarkRouterMatch(b *testing.B) {
+	r := New()
+	for i := 0; i < 100; i++ {
+		r.Get(fmt.Sprintf("/v1/resource%d", i), noopHandler)
+		r.Get(fmt.Sprintf("/v1/resource%d/{id}", i), noopHandler)
+		r.Get(fmt.Sprintf("/v1/resource%d/{id}/items", i), noopHandler)
+		r.Get(fmt.Sprintf("/v1/resource%d/{id}/items/{item}", i), noopHandler)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := r.Match("GET", "/v1/resource99/42/items/7"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRouterLoad(t *testing.T) {
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %q %v", name, Params(r), Meta(r))
+		}
+	}
+	tag := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Tag", "tagged")
+			next.ServeHTTP(w, r)
+		})
+	}
+	reg := NewRegistry().
+		Handler("users.get", echo("get")).
+		Handler("users.delete", echo("delete")).
+		Middleware("tag", tag)
+
+	r := New()
+	err := r.LoadJSON([]byte(`{"routes": [
+		{"method": "GET", "template": "/v1/users/{id}", "handler": "users.get", "name": "user", "middleware": ["tag"], "meta": {"scope": "users"}},
+		{"method": "DELETE", "template": "/v1/users/{id}", "handler": "users.delete", "disabled": true}
+	]}`), reg)
+	if err != nil {
+		t.Fatalf("r.LoadJSON failed with %v; want success", err)
+	}
+	for _, spec := range []struct {
+		method string
+		code   int
+		want   string
+		tag    string
+	}{
+		{method: "GET", code: http.StatusOK, want: `get ["42"] map[scope:users]`, tag: "tagged"},
+		{method: "DELETE", code: http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(spec.method, "/v1/users/42", nil))
+		if w.Code != spec.code {
+			t.Errorf("%s: w.Code = %d; want %d", spec.method, w.Code, spec.code)
+		}
+		if got := w.Body.String(); spec.want != "" && got != spec.want {
+			t.Errorf("%s: w.Body = %q; want %q", spec.method, got, spec.want)
+		}
+		if got := w.Header().Get("X-Tag"); got != spec.tag {
+			t.Errorf("%s: X-Tag = %q; want %q", spec.method, got, spec.tag)
+		}
+	}
+	if u, err := r.URL("user", "id", "7"); err != nil || u != "/v1/users/7" {
+		t.Errorf("r.URL(%q) = %q, %v; want %q", "user", u, err, "/v1/users/7")
+	}
+
+	err = r.LoadJSON([]byte(`{"routes": [
+		{"method": "GET", "template": "/v1/books", "handler": "users.get"},
+		{"method": "GET", "template": "/v1/users/{id}", "handler": "users.get"},
+		{"template": "/v1/users/{id", "handler": "users.list", "middleware": ["auth"]},
+		{"method": "PUT", "template": "/v1/users/{id}", "handler": "users.get", "disabled": true, "name": "user"},
+		{"method": "GTE", "template": "/v1/shelves", "handler": "users.get"}
+	]}`), reg)
+	if err == nil {
+		t.Fatalf("r.LoadJSON succeeded; want failure")
+	}
+	for _, want := range []string{
+		"route 1 (GET /v1/users/{id}): ",
+		`route 2 ( /v1/users/{id): missing method`,
+		`unknown handler "users.list"`,
+		`unknown middleware "auth"`,
+		`route 4 (GTE /v1/shelves): invalid method "GTE"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("r.LoadJSON failed with %q; want it contains %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "route 0") || strings.Contains(err.Error(), "route 3") {
+		t.Errorf("r.LoadJSON failed with %q; want the valid routes not reported", err)
+	}
+	if _, _, _, err := r.Match("GET", "/v1/books"); err != ErrNotMatch {
+		t.Errorf("r.Match(%q) after failed load = %v; want %v", "/v1/books", err, ErrNotMatch)
+	}
+
+	if err := r.LoadJSON([]byte(`{"routes": [{"method": "GET", "template": "/v1", "handler": "users.get", "path": "/v2"}]}`), reg); err == nil {
+		t.Errorf("r.LoadJSON with unknown field succeeded; want failure")
+	}
+
+	//the route file decoded by another unmarshal, its unknown keys are reported too
+	if err := New().LoadConfig([]byte(`{"version": 1, "routes": [{"method": "GET", "template": "/v1", "handler": "users.get", "path": "/v2"}]}`),
+		json.Unmarshal, reg); err == nil || !strings.Contains(err.Error(), `unknown field "version"`) ||
+		!strings.Contains(err.Error(), `route 0: unknown field "path"`) {
+		t.Errorf("LoadConfig with unknown fields failed with %v; want the unknown fields reported", err)
+	}
+	if err := unknownFields(map[string]interface{}{"routes": []interface{}{map[interface{}]interface{}{"method": "GET", "path": "/v2"}}}); err == nil ||
+		err.Error() != `route 0: unknown field "path"` {
+		t.Errorf("unknownFields of the maps with interface{} keys = %v; want %q", err, `route 0: unknown field "path"`)
+	}
+	y := New()
+	err = y.LoadConfig([]byte(`{"routes": [
+		{"method": "*", "template": "/v1/shelves/{id}", "handler": "users.get", "host": "{tenant}.example.com", "name": "shelf", "middleware": ["tag"], "meta": {"scope": "shelves"}},
+		{"method": "GET", "template": "/v1/books/{id}", "handler": "users.get", "disabled": true}
+	]}`), json.Unmarshal, reg)
+	if err != nil {
+		t.Fatalf("y.LoadConfig failed with %v; want success", err)
+	}
+	req := httptest.NewRequest("POST", "/v1/shelves/7", nil)
+	req.Host = "acme.example.com"
+	w := httptest.NewRecorder()
+	y.ServeHTTP(w, req)
+	if got, want := w.Body.String(), `get ["acme" "7"] map[scope:shelves]`; got != want {
+		t.Errorf("POST acme.example.com/v1/shelves/7: w.Body = %q; want %q", got, want)
+	}
+	if got := w.Header().Get("X-Tag"); got != "tagged" {
+		t.Errorf("POST acme.example.com/v1/shelves/7: X-Tag = %q; want %q", got, "tagged")
+	}
+	if u, err := y.URL("shelf", "id", "7"); err != nil || u != "/v1/shelves/7" {
+		t.Errorf("y.URL(%q) = %q, %v; want %q", "shelf", u, err, "/v1/shelves/7")
+	}
+	if _, _, _, err := y.Match("GET", "/v1/books/1"); err != ErrNotMatch {
+		t.Errorf("y.Match(%q) of disabled route = %v; want %v", "/v1/books/1", err, ErrNotMatch)
+	}
+}
+
+func TestRouterInvoker(t *testing.T) {
+	serve := func(r *Router, path string) (int, string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+	reflected := New()
+	reflected.Get("/shelves/{name}/{id}", (*testContext).Shelf)
+
+	var calls int
+	RegisterInvoker((*testContext).Shelf, Invoker{
+		New: func() ContextInterface { return new(testContext) },
+		Call: func(ctx ContextInterface, params []string) []interface{} {
+			calls++
+			p1, _ := strconv.Atoi(params[1])
+			r0, r1 := ctx.(*testContext).Shelf(params[0], p1)
+			return []interface{}{r0, r1}
+		},
+	})
+	invoked := New()
+	invoked.Get("/shelves/{name}/{id}", (*testContext).Shelf)
+
+	for _, path := range []string{"/shelves/a/42", "/shelves/a/0", "/shelves/a/b"} {
+		code, body := serve(invoked, path)
+		wantCode, wantBody := serve(reflected, path)
+		if code != wantCode || body != wantBody {
+			t.Errorf("GET %s = %d %q; want %d %q", path, code, body, wantCode, wantBody)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("invoker calls = %d; want %d", calls, 2)
+	}
+}
+
+type listRequest struct {
+	PageSize int `query:"page_size"`
+	Filter   struct {
+		State string `json:"state"`
+	} `json:"filter"`
+	IDs     []int `json:"ids"`
+	Parent  string
+	IsAdmin bool `json:"-"`
+}
+
+func (c *testContext) List(req *listRequest) {
+	c.Text(fmt.Sprintf("%s/%d/%s/%v/%t", req.Parent, req.PageSize, req.Filter.State, req.IDs, req.IsAdmin))
+}
+
+func TestRouterQueryBinding(t *testing.T) {
+	r := New()
+	r.Get("/v1/{parent=shelves/*}/books", (*testContext).List)
+	r.Post("/v1/{parent=shelves/*}/books", (*testContext).List)
+	strict := New()
+	strict.DisallowUnknownQuery = true
+	strict.Get("/v1/{parent=shelves/*}/books", (*testContext).List)
+	for _, spec := range []struct {
+		r      *Router
+		method string
+		path   string
+		form   string
+		code   int
+		want   []string
+	}{
+		{r: r, method: "GET", path: "/v1/shelves/s1/books?page_size=10&filter.state=ACTIVE&ids=1&ids=2&unknown=1",
+			code: http.StatusOK, want: []string{"shelves/s1/10/ACTIVE/[1 2]"}},
+		//the path variables win
+		{r: r, method: "GET", path: "/v1/shelves/s1/books?parent=shelves/s2", code: http.StatusOK, want: []string{"shelves/s1/0//[]"}},
+		{r: r, method: "POST", path: "/v1/shelves/s1/books?ids=1", form: "page_size=5&ids=3",
+			code: http.StatusOK, want: []string{"shelves/s1/5//[1 3]"}},
+		{r: r, method: "GET", path: "/v1/shelves/s1/books?page_size=x&ids=1&ids=y&page_size=2", code: http.StatusBadRequest,
+			want: []string{`"field_violations"`, `"field":"ids"`, `"field":"page_size","description":"too many values: 2"`}},
+		{r: strict, method: "GET", path: "/v1/shelves/s1/books?page_size=10", code: http.StatusOK, want: []string{"shelves/s1/10//[]"}},
+		{r: strict, method: "GET", path: "/v1/shelves/s1/books?page_size=10&filter.color=red", code: http.StatusBadRequest,
+			want: []string{`"field":"filter.color","description":"unknown field"`}},
+		//the fields tagged "-" and the empty names are never bound
+		{r: r, method: "GET", path: "/v1/shelves/s1/books?isadmin=true&is_admin=true&=x", code: http.StatusOK, want: []string{"shelves/s1/0//[]/false"}},
+		{r: strict, method: "GET", path: "/v1/shelves/s1/books?isadmin=true", code: http.StatusBadRequest,
+			want: []string{`"field":"isadmin","description":"unknown field"`}},
+		{r: strict, method: "GET", path: "/v1/shelves/s1/books?=x", code: http.StatusBadRequest,
+			want: []string{`"field_violations":[{"description":"unknown field"}]`}},
+		{r: strict, method: "GET", path: "/v1/shelves/s1/books?filter..state=x", code: http.StatusBadRequest,
+			want: []string{`"field":"filter..state","description":"unknown field"`}},
+	} {
+		req := httptest.NewRequest(spec.method, spec.path, strings.NewReader(spec.form))
+		if spec.form != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		spec.r.ServeHTTP(w, req)
+		if w.Code != spec.code {
+			t.Errorf("%s %s: w.Code = %d; want %d", spec.method, spec.path, w.Code, spec.code)
+		}
+		for _, want := range spec.want {
+			if got := w.Body.String(); !strings.Contains(got, want) {
+				t.Errorf("%s %s: w.Body = %q; want to contain %q", spec.method, spec.path, got, want)
+			}
+		}
+	}
+}
+
+type createBookRequest struct {
+	Title string `json:"title" xml:"title"`
+	Book  struct {
+		Title string `json:"title"`
+	} `json:"book"`
+}
+
+func (c *testContext) CreateBook(shelf string, id int, body *createBookRequest) {
+	c.Text(fmt.Sprintf("%s/%d/%s/%s", shelf, id, body.Title, body.Book.Title))
+}
+
+func TestRouterBodyParam(t *testing.T) {
+	r := New()
+	r.Post("/v1/shelves/{shelf}/books/{id}", (*testContext).CreateBook)
+	r.Put("/v1/shelves/{shelf}/books/{id}", (*testContext).CreateBook, WithBody("book"))
+	r.Post("/v1/projects/{project_id}/books", (*testContext).GetBook)
+	r.Get("/v1/projects/{project_id}/books", (*testContext).GetBook)
+	r.Patch("/v1/projects/{project_id}/books", (*testContext).GetBook, WithBody("book"))
+	r.Delete("/v1/projects/{project_id}/books", (*testContext).GetBook)
+	r.Delete("/v1/shelves/{shelf}/books/{id}", (*testContext).CreateBook)
+	r.Post("/v1/books", (*testContext).GetBook)
+	for _, spec := range []struct {
+		path string
+		body string
+		opts []RouteOption
+	}{
+		{path: "/v1/shelves/{shelf}/books/{id}", opts: []RouteOption{WithBody("author")}},
+		{path: "/v1/projects/{project_id}", body: "*"},
+	} {
+		var v interface{} = (*testContext).CreateBook
+		if spec.body != "" {
+			v = noopHandler
+			spec.opts = append(spec.opts, WithBody(spec.body))
+		}
+		if err := r.Handle("POST", spec.path, v, spec.opts...); err == nil {
+			t.Errorf("r.Handle(%q) succeeded; want error", spec.path)
+		}
+	}
+	for _, spec := range []struct {
+		method      string
+		path        string
+		contentType string
+		body        string
+		code        int
+		want        string
+	}{
+		{method: "POST", path: "/v1/shelves/s1/books/1", body: `{"title":"a"}`, code: http.StatusOK, want: "s1/1/a/"},
+		{method: "POST", path: "/v1/shelves/s1/books/1", contentType: "application/json", body: `{"title":"a"}`, code: http.StatusOK, want: "s1/1/a/"},
+		{method: "POST", path: "/v1/shelves/s1/books/1", contentType: "application/xml", body: `<book><title>x</title></book>`, code: http.StatusOK, want: "s1/1/x/"},
+		{method: "POST", path: "/v1/shelves/s1/books/1", code: http.StatusOK, want: "s1/1//"},
+		{method: "POST", path: "/v1/shelves/s1/books/1", body: `{"title":`, code: http.StatusBadRequest},
+		{method: "POST", path: "/v1/shelves/s1/books/1", contentType: "text/csv", body: `a,b`, code: http.StatusBadRequest},
+		{method: "PUT", path: "/v1/shelves/s1/books/1", body: `{"title":"b"}`, code: http.StatusOK, want: "s1/1//b"},
+		{method: "POST", path: "/v1/projects/p1/books?tenant=t1", body: `{"tenant":"t2","project_id":"p2","book":{"id":3}}`, code: http.StatusOK, want: "t1/p1//3"},
+		//the body is decoded on every method, whether the struct is a request struct or a body param
+		{method: "GET", path: "/v1/projects/p1/books", body: `{"book":{"id":3}}`, code: http.StatusOK, want: "/p1//3"},
+		{method: "GET", path: "/v1/projects/p1/books", code: http.StatusOK, want: "/p1//0"},
+		{method: "PATCH", path: "/v1/projects/p1/books", body: `{"id":3}`, code: http.StatusOK, want: "/p1//3"},
+		{method: "DELETE", path: "/v1/projects/p1/books", body: `{"book":{"id":3}}`, code: http.StatusOK, want: "/p1//3"},
+		{method: "DELETE", path: "/v1/shelves/s1/books/1", body: `{"title":"a"}`, code: http.StatusOK, want: "s1/1/a/"},
+		{method: "POST", path: "/v1/books", body: `{"tenant":"t1","book":{"id":3}}`, code: http.StatusOK, want: "t1///3"},
+	} {
+		req := httptest.NewRequest(spec.method, spec.path, strings.NewReader(spec.body))
+		if spec.contentType != "" {
+			req.Header.Set("Content-Type", spec.contentType)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != spec.code {
+			t.Errorf("%s %s: w.Code = %d; want %d", spec.method, spec.path, w.Code, spec.code)
+		}
+		if got := w.Body.String(); spec.want != "" && got != spec.want {
+			t.Errorf("%s %s: w.Body = %q; want %q", spec.method, spec.path, got, spec.want)
+		}
+	}
+}
+
+type shelfRequest struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	PageSize int    `json:"page_size"`
+}
+
+type shelfResponse struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	PageSize int    `json:"page_size,omitempty"`
+}
+
+//shelfContext a context of typed handlers which decodes the request
+type shelfContext struct {
+	Context
+	user string
+}
+
+func (c *shelfContext) DecodeRequest() error {
+	c.user = c.Request.Header.Get("X-User")
+	return nil
+}
+
+func TestRouterTypedHandle(t *testing.T) {
+	getShelf := func(ctx *Context, req *shelfRequest) (*shelfResponse, error) {
+		if req.ID == 0 {
+			return nil, errors.CodeError(errors.NotFound).WithDescription("shelf not found")
+		}
+		return &shelfResponse{ID: req.ID, Name: req.Name, PageSize: req.PageSize}, nil
+	}
+	r := New()
+	if err := Handle(r, "GET", "/v1/shelves/{id}", getShelf); err != nil {
+		t.Fatalf("Handle failed with %v; want success", err)
+	}
+	if err := Handle(r.Group("/v2"), "POST", "/shelves/{id}", getShelf); err != nil {
+		t.Fatalf("Handle in group failed with %v; want success", err)
+	}
+	if err := Handle(r, "PATCH", "/v1/shelves/{id}", getShelf, WithBody("name")); err != nil {
+		t.Fatalf("Handle with body field failed with %v; want success", err)
+	}
+	if err := Handle(r, "GET", "/v1/shelves/{id}/{name}/{shelf}", getShelf); err == nil {
+		t.Errorf("Handle with unknown variable succeeded; want failure")
+	}
+	//the contexts of typed handlers decode the request before the handler
+	if err := Handle(r, "GET", "/v3/shelves/{id}", func(ctx *shelfContext, req *shelfRequest) (*shelfResponse, error) {
+		return &shelfResponse{ID: req.ID, Name: ctx.user}, nil
+	}); err != nil {
+		t.Fatalf("Handle with custom context failed with %v; want success", err)
+	}
+	if err := Handle(r, "POST", "/v3/shelves/{id}", func(ctx *decodeContext, req *shelfRequest) (*shelfResponse, error) {
+		return &shelfResponse{ID: req.ID}, nil
+	}); err != nil {
+		t.Fatalf("Handle with custom context failed with %v; want success", err)
+	}
+	for _, spec := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+		want   string
+	}{
+		{method: "GET", path: "/v1/shelves/42?name=a&page_size=10&unknown=1", code: http.StatusOK, want: `{"id":42,"name":"a","page_size":10}`},
+		{method: "GET", path: "/v1/shelves/0", code: http.StatusNotFound},
+		{method: "GET", path: "/v1/shelves/x", code: http.StatusNotFound},
+		{method: "GET", path: "/v1/shelves/42?page_size=x", code: http.StatusBadRequest},
+		{method: "POST", path: "/v2/shelves/7", body: `{"id":1,"name":"b"}`, code: http.StatusOK, want: `{"id":7,"name":"b"}`},
+		{method: "POST", path: "/v2/shelves/7", body: `{"id":`, code: http.StatusBadRequest},
+		{method: "PATCH", path: "/v1/shelves/7", body: `"c"`, code: http.StatusOK, want: `{"id":7,"name":"c"}`},
+		{method: "GET", path: "/v3/shelves/7", code: http.StatusOK, want: `{"id":7,"name":"u1"}`},
+		{method: "POST", path: "/v3/shelves/7?denied=1", code: http.StatusForbidden, want: `{"error":"denied"}`},
+	} {
+		req := httptest.NewRequest(spec.method, spec.path, strings.NewReader(spec.body))
+		if spec.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("X-User", "u1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != spec.code {
+			t.Errorf("%s %s: w.Code = %d; want %d", spec.method, spec.path, w.Code, spec.code)
+		}
+		if got := w.Body.String(); spec.want != "" && got != spec.want {
+			t.Errorf("%s %s: w.Body = %q; want %q", spec.method, spec.path, got, spec.want)
+		}
+	}
+}
+
+func TestRouterParamTypes(t *testing.T) {
+	r := New()
+	r.Get("/types/{a}/{b}/{d}/{l}/{id}/{color}/{path=**}", (*testContext).Types)
+	r.Get("/events/{at}/{color}/{tags=**}", (*testContext).Event)
+	r.Get("/events/{name}/{color}/{tags=**}", noopHandler)
+	r.RegisterParamType(reflect.TypeOf(testColor{}), func(s string) (interface{}, error) {
+		var c testColor
+		if _, err := fmt.Sscanf(s, "%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+	//the pointer to a registered struct type is a param, not a request struct
+	if err := r.Handle("GET", "/paint/{color}", (*testContext).Paint); err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range []struct {
+		path string
+		code int
+		want string
+	}{
+		{
+			path: "/types/-7/7/1m30s/3/0102030405060708090a0b0c0d0e0f10/ff8000/a/b/c",
+			code: http.StatusOK,
+			want: `-7 7 1m30s 3 0102 {255 128 0} ["a" "b" "c"]`,
+		},
+		//the escaped "/" belongs to a segment of multi-segment variable
+		{
+			path: "/types/-7/7/1m30s/3/0102030405060708090a0b0c0d0e0f10/ff8000/a%2Fb/c%25d",
+			code: http.StatusOK,
+			want: `-7 7 1m30s 3 0102 {255 128 0} ["a/b" "c%d"]`,
+		},
+		{path: "/paint/ff8000", code: http.StatusOK, want: `{255 128 0}`},
+		{path: "/types/2147483648/7/1s/3/0102030405060708090a0b0c0d0e0f10/ff8000/a", code: http.StatusNotFound},
+		{path: "/types/1/-7/1s/3/0102030405060708090a0b0c0d0e0f10/ff8000/a", code: http.StatusNotFound},
+		{path: "/types/1/7/1x/3/0102030405060708090a0b0c0d0e0f10/ff8000/a", code: http.StatusNotFound},
+		{path: "/types/1/7/1s/3/0102/ff8000/a", code: http.StatusNotFound},
+		{path: "/types/1/7/1s/3/0102030405060708090a0b0c0d0e0f10/red/a", code: http.StatusNotFound},
+		{path: "/events/2024-01-02T03:04:05Z/000000/x/y", code: http.StatusOK, want: `2024-01-02T03:04:05Z ["x" "y"] {0 0 0}`},
+		//the invalid time falls through to the next route
+		{path: "/events/today/000000/x", code: http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", spec.path, nil))
+		if w.Code != spec.code {
+			t.Errorf("GET %s: w.Code = %d; want %d", spec.path, w.Code, spec.code)
+		}
+		if got := w.Body.String(); spec.want != "" && got != spec.want {
+			t.Errorf("GET %s: w.Body = %q; want %q", spec.path, got, spec.want)
+		}
+	}
+}
+
+//newBenchRouter returns a router with static and variable routes of many resources
+func newBenchRouter() *Router {
+	r := New()
+	for i := 0; i < 100; i++ {
+		r.Get(fmt.Sprintf("/v1/resource%d", i), noopHandler)
+		r.Get(fmt.Sprintf("/v1/resource%d/{id}", i), noopHandler)
+		r.Get(fmt.Sprintf("/v1/resource%d/{id}/items", i), noopHandler)
+	}
+	return r
+}
+
+func (c *testContext) Label(id string) {}
+
+func (c *testContext) Count(n int) {}
+
+func TestRouterAllocs(t *testing.T) {
+	r := newBenchRouter()
+	r.Get("/v1/contexts/{id}", (*testContext).Label)
+	r.Get("/v1/counts/{n}", (*testContext).Count)
+	w := httptest.NewRecorder()
+	var ps PathParams
+	for _, spec := range []struct {
+		path string
+		//serve the allocations of ServeHTTP which the handler owns
+		serve float64
+	}{
+		{path: "/v1/resource99", serve: 0},
+		//the params of http handlers are copied to Params(req)
+		{path: "/v1/resource99/42", serve: 1},
+		//the new context of each request
+		{path: "/v1/contexts/42", serve: 1},
+		{path: "/v1/counts/42", serve: 1},
+	} {
+		if allocs := testing.AllocsPerRun(100, func() {
+			r.MatchParams("GET", "", spec.path, &ps)
+		}); allocs != 0 {
+			t.Errorf("r.MatchParams(%q) allocates %v times; want 0", spec.path, allocs)
+		}
+		req := httptest.NewRequest("GET", spec.path, nil)
+		if allocs := testing.AllocsPerRun(100, func() {
+			r.ServeHTTP(w, req)
+		}); allocs != spec.serve {
+			t.Errorf("r.ServeHTTP(%q) allocates %v times; want %v", spec.path, allocs, spec.serve)
+		}
+	}
+}
+
+func TestRouterParamsOutliveServeHTTP(t *testing.T) {
+	got := make(chan []string, 2)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		got <- append([]string(nil), Params(req)...)
+	})
+	detach := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			go next.ServeHTTP(w, req)
+		})
+	}
+	r := New()
+	r.Get("/items/{id}", slow, WithMiddleware(detach))
+	r.Get("/detached/{id}", detach(slow))
+	r.Get("/other/{a}/{b}", noopHandler)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/42", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/detached/42", nil))
+	//the pooled params are reused by the next requests while the handlers are still running
+	for i := 0; i < 10; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other/x/y", nil))
+	}
+	for i := 0; i < 2; i++ {
+		if params := <-got; !reflect.DeepEqual(params, []string{"42"}) {
+			t.Errorf("Params(req) after ServeHTTP returns = %q; want %q", params, []string{"42"})
+		}
+	}
+}
+
+func benchmarkMatch(b *testing.B, path string) {
+	r := newBenchRouter()
+	var ps PathParams
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.MatchParams("GET", "", path, &ps); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRouterMatchStatic(b *testing.B) { benchmarkMatch(b, "/v1/resource99") }
+func BenchmarkRouterMatchParam(b *testing.B)  { benchmarkMatch(b, "/v1/resource99/42") }
+
+func benchmarkServeHTTP(b *testing.B, path string) {
+	r := newBenchRouter()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", path, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkRouterServeHTTPStatic(b *testing.B) { benchmarkServeHTTP(b, "/v1/resource99") }
+func BenchmarkRouterServeHTTPParam(b *testing.B)  { benchmarkServeHTTP(b, "/v1/resource99/42") }
@@ -0,0 +1,113 @@
+package ctxrouter
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+)
+
+//RouteInfo the information of a registered route
+type RouteInfo struct {
+	//Method the http method, "*" for all methods
+	Method string
+	//Host the host template, it is empty for the routes without host template
+	Host string
+	//Template the original path template, exp: /v1/users/{id}
+	Template string
+	//Name the name of route, see WithName
+	Name string
+	//Vars the variable names of path template, in the order of params
+	Vars []string
+	//Verb the verb of path template
+	Verb string
+	//Handler the name of handler function, or the type of http.Handler
+	Handler string
+	//Context the context type of handler, it is nil for http handlers
+	Context reflect.Type
+	//Params the types of handler params after the context
+	Params []reflect.Type
+	//Meta the metadata of route, see WithMeta
+	Meta map[string]interface{}
+}
+
+//Routes returns the information of all registered routes in match order, see Walk
+func (s *Router) Routes() []RouteInfo {
+	var routes []RouteInfo
+	s.Walk(func(route RouteInfo) error {
+		routes = append(routes, route)
+		return nil
+	})
+	return routes
+}
+
+//Walk calls fn for each registered route in match order:
+//the routes of host templates before the routes without host, the methods in alphabetical order before "*",
+//and the routes of a method from the most specific to the least.
+//Walk stops and returns the error as soon as fn returns an error.
+func (s *Router) Walk(fn func(route RouteInfo) error) error {
+	snap := s.load()
+	for _, ht := range snap.hosts {
+		if err := ht.table.walk(ht.template, fn); err != nil {
+			return err
+		}
+	}
+	return snap.routes.walk("", fn)
+}
+
+//walk calls fn for each route of the table in match order
+func (t *table) walk(host string, fn func(route RouteInfo) error) error {
+	methods := make([]string, 0, len(t.trees))
+	for method := range t.trees {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		if methods[i] == "*" || methods[j] == "*" {
+			return methods[j] == "*" && methods[i] != "*"
+		}
+		return methods[i] < methods[j]
+	})
+	for _, method := range methods {
+		err := t.trees[method].walk(func(h *Handler) error {
+			return fn(h.info(method, host))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//info returns the RouteInfo of handler
+func (h *Handler) info(method, host string) RouteInfo {
+	info := RouteInfo{
+		Method:   method,
+		Host:     host,
+		Template: h.template,
+		Name:     h.Name,
+		Vars:     append([]string(nil), h.Pat.vars...),
+		Verb:     h.Pat.verb,
+		Context:  h.callT,
+		Params:   append([]reflect.Type(nil), h.paramsT...),
+		Meta:     h.Meta,
+	}
+	if h.bodyT != nil {
+		info.Params = append(info.Params, h.bodyT)
+	}
+	v := h.V
+	if m, ok := v.(mount); ok {
+		v = m.handler
+	}
+	if f, ok := v.(http.HandlerFunc); ok {
+		v = (func(http.ResponseWriter, *http.Request))(f)
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Func {
+		if f := runtime.FuncForPC(rv.Pointer()); f != nil {
+			info.Handler = f.Name()
+		}
+	} else {
+		info.Handler = fmt.Sprintf("%T", v)
+	}
+	return info
+}
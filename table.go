@@ -0,0 +1,127 @@
+package ctxrouter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//table the routes of router indexed by method
+type table struct {
+	trees map[string]*node
+	//gen the update which the table belongs to, the nodes of other updates are copied before they are modified
+	gen uint64
+}
+
+func newTable(gen uint64) *table {
+	return &table{
+		trees: make(map[string]*node),
+		gen:   gen,
+	}
+}
+
+//insert add the handler of method to the table
+func (t *table) insert(method string, h *Handler) {
+	t.trees[method] = t.trees[method].insert(h, t.gen)
+}
+
+//clone returns a copy of table which can be modified by the update of gen, the trees are shared until they are modified
+func (t *table) clone(gen uint64) *table {
+	c := newTable(gen)
+	for method, root := range t.trees {
+		c.trees[method] = root
+	}
+	return c
+}
+
+//remove removes the handlers of method with the same template as h, and returns them
+func (t *table) remove(method string, h *Handler) (removed []*Handler) {
+	root, ok := t.trees[method]
+	if !ok {
+		return nil
+	}
+	root, removed = root.remove(h.Pat.steps(), t.gen, func(e *Handler) bool {
+		return sameTemplate(e, h)
+	})
+	if root.empty() {
+		delete(t.trees, method)
+	} else {
+		t.trees[method] = root
+	}
+	return removed
+}
+
+//conflict checks if the handler conflicts with the handlers of method in the table.
+//Two routes without matchers which match exactly the same paths are ambiguous, the same templates are duplicate.
+//In strict mode, a route is also rejected if it is shadowed by a route without matchers registered before it,
+//which matches the same paths with the same precedence. The routes with different constraints never conflict.
+func (t *table) conflict(method string, h *Handler, strict bool) error {
+	//the equivalent patterns have the same steps, so they are kept at the same node
+	for _, e := range t.trees[method].find(h.Pat.steps()) {
+		if !e.Pat.equivalent(h.Pat) {
+			continue
+		}
+		switch {
+		case !sameConstraints(e, h):
+			continue
+		case len(e.matchers) == 0 && len(h.matchers) == 0:
+			if e.Pat.String() == h.Pat.String() {
+				return fmt.Errorf("duplicate route %s %s", method, h.Pat)
+			}
+			return fmt.Errorf("ambiguous route %s %s, it matches the same paths as %s", method, h.Pat, e.Pat)
+		case strict && len(e.matchers) == 0:
+			return fmt.Errorf("route %s %s is shadowed by %s", method, h.Pat, e.Pat)
+		}
+	}
+	return nil
+}
+
+// match finds the handler of the method for the components.
+// If the last component has a VERB part, the patterns with a verb are tried first,
+// then the verb is treated as a part of the last component for the patterns without one.
+// The params captured by the host template are bound before the params of path.
+// The matchers of handlers are evaluated if req is not nil.
+func (t *table) match(req *http.Request, method string, components []string, ps *PathParams) *Handler {
+	root, ok := t.trees[method]
+	if !ok {
+		return nil
+	}
+	l := len(components)
+	last := components[l-1]
+	if idx := strings.LastIndex(last, ":"); idx > 0 {
+		components[l-1] = last[:idx]
+		h := matchTree(req, root, components, last[idx+1:], ps)
+		components[l-1] = last
+		if h != nil {
+			return h
+		}
+	}
+	return matchTree(req, root, components, "", ps)
+}
+
+// matchTree returns the first handler of the tree which matches the components and verb,
+// the values of its variables are captured into ps.
+func matchTree(req *http.Request, root *node, components []string, verb string, ps *PathParams) (h *Handler) {
+	base := len(ps.hostVars)
+	root.lookup(components, func(handler *Handler) bool {
+		if !handler.Pat.match(components, verb, ps) || (req != nil && !handler.matches(req)) {
+			return false
+		}
+		var multi []bool
+		for i := base; i < ps.n; i++ {
+			if v := ps.Value(i); strings.IndexByte(v, '%') >= 0 {
+				if multi == nil {
+					multi = handler.Pat.multiSegment()
+				}
+				ps.set(i, unescapeCapture(v, multi[i-base]))
+			}
+		}
+		//the params which can not be converted to the types of handler try the next route
+		if !handler.satisfies(ps) || !handler.accepts(ps) {
+			return false
+		}
+		h = handler
+		return true
+	})
+	return
+}
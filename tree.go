@@ -0,0 +1,318 @@
+package ctxrouter
+
+import (
+	"sort"
+	"strings"
+)
+
+// node is a node of the per-method routing tree.
+// Every edge of the tree consumes exactly one path component, following the
+// OpLitPush and OpPush operations of the compiled patterns. Patterns which
+// continue with OpPushM are kept at the node where the deep wildcard starts.
+//
+// The trees are shared by the snapshots of routes, a node is never modified after the update
+// which created it is stored, the later updates copy the nodes on the path of the changed route.
+type node struct {
+	// gen is the update which created the node, see table.gen
+	gen uint64
+	// static holds the children reached by OpLitPush, indexed by the literal
+	static map[string]*node
+	// mixed are the children reached by OpPush of mixed segments, most specific first
+	mixed []*mixedNode
+	// wildcard is the child reached by OpPush
+	wildcard *node
+	// leaves are the handlers whose patterns end at this node, most specific first
+	leaves []*Handler
+	// deep are the handlers whose patterns continue with OpPushM at this node, most specific first
+	deep []*Handler
+}
+
+// mixedNode is a child of node reached by the mixed segments of the same shape.
+type mixedNode struct {
+	step
+	*node
+}
+
+// mutable returns n if it was created by the update of gen, otherwise a copy of n which is.
+// A nil node is returned as a new empty node.
+func (n *node) mutable(gen uint64) *node {
+	if n == nil {
+		return &node{gen: gen}
+	}
+	if n.gen == gen {
+		return n
+	}
+	c := *n
+	c.gen = gen
+	if n.static != nil {
+		c.static = make(map[string]*node, len(n.static))
+		for lit, child := range n.static {
+			c.static[lit] = child
+		}
+	}
+	c.mixed = append([]*mixedNode(nil), n.mixed...)
+	return &c
+}
+
+// insert adds the handler to the tree of root n by the update of gen, and returns the new root.
+// Only the nodes on the path of the handler are copied.
+func (n *node) insert(h *Handler, gen uint64) *node {
+	root := n.mutable(gen)
+	n = root
+	for _, st := range h.Pat.steps() {
+		switch {
+		case st.code == OpLitPush:
+			if n.static == nil {
+				n.static = make(map[string]*node)
+			}
+			child := n.static[st.lit].mutable(gen)
+			n.static[st.lit] = child
+			n = child
+		case st.mixed():
+			n = n.mixedChild(st, gen)
+		case st.code == OpPush:
+			n.wildcard = n.wildcard.mutable(gen)
+			n = n.wildcard
+		case st.code == OpPushM:
+			n.deep = insertHandler(n.deep, h)
+			return root
+		}
+	}
+	n.leaves = insertHandler(n.leaves, h)
+	return root
+}
+
+// mixedChild returns the mutable child of the mixed segment shape, it is created if it does not exist.
+// The children are ordered by the number of literal bytes in their shapes, see Pattern.precedes.
+func (n *node) mixedChild(st step, gen uint64) *node {
+	i := len(n.mixed)
+	for j, m := range n.mixed {
+		if m.lit == st.lit {
+			if child := m.node.mutable(gen); child != m.node {
+				n.mixed[j] = &mixedNode{step: m.step, node: child}
+			}
+			return n.mixed[j].node
+		}
+		if m.literals() < st.literals() && j < i {
+			i = j
+		}
+	}
+	m := &mixedNode{step: st, node: &node{gen: gen}}
+	n.mixed = append(n.mixed, nil)
+	copy(n.mixed[i+1:], n.mixed[i:])
+	n.mixed[i] = m
+	return m.node
+}
+
+// child returns the child reached by the step, it is nil if there is none.
+func (n *node) child(st step) *node {
+	switch {
+	case st.code == OpLitPush:
+		return n.static[st.lit]
+	case st.mixed():
+		for _, m := range n.mixed {
+			if m.lit == st.lit {
+				return m.node
+			}
+		}
+		return nil
+	default:
+		return n.wildcard
+	}
+}
+
+// find returns the handlers kept at the node of the steps, see insert.
+func (n *node) find(steps []step) []*Handler {
+	for _, st := range steps {
+		if n == nil {
+			return nil
+		}
+		if st.code == OpPushM {
+			return n.deep
+		}
+		n = n.child(st)
+	}
+	if n == nil {
+		return nil
+	}
+	return n.leaves
+}
+
+// remove removes the handlers at the node of the steps which fn reports by the update of gen,
+// and returns the new root and the removed handlers. The tree is not copied if nothing is removed.
+func (n *node) remove(steps []step, gen uint64, fn func(*Handler) bool) (*node, []*Handler) {
+	if n == nil {
+		return nil, nil
+	}
+	if len(steps) == 0 || steps[0].code == OpPushM {
+		list := n.leaves
+		if len(steps) > 0 {
+			list = n.deep
+		}
+		var kept, removed []*Handler
+		for _, h := range list {
+			if fn(h) {
+				removed = append(removed, h)
+			} else {
+				kept = append(kept, h)
+			}
+		}
+		if len(removed) == 0 {
+			return n, nil
+		}
+		c := n.mutable(gen)
+		if len(steps) > 0 {
+			c.deep = kept
+		} else {
+			c.leaves = kept
+		}
+		return c, removed
+	}
+	st := steps[0]
+	child, removed := n.child(st).remove(steps[1:], gen, fn)
+	if len(removed) == 0 {
+		return n, nil
+	}
+	c := n.mutable(gen)
+	//the children without routes are pruned, so that removing routes does not grow the tree
+	switch {
+	case st.code == OpLitPush && child.empty():
+		delete(c.static, st.lit)
+	case st.code == OpLitPush:
+		c.static[st.lit] = child
+	case st.mixed():
+		for j, m := range c.mixed {
+			if m.lit != st.lit {
+				continue
+			}
+			if child.empty() {
+				c.mixed = append(c.mixed[:j], c.mixed[j+1:]...)
+			} else {
+				c.mixed[j] = &mixedNode{step: m.step, node: child}
+			}
+			break
+		}
+	case child.empty():
+		c.wildcard = nil
+	default:
+		c.wildcard = child
+	}
+	return c, removed
+}
+
+// empty reports whether the tree of n has no handlers.
+func (n *node) empty() bool {
+	return len(n.static) == 0 && len(n.mixed) == 0 && n.wildcard == nil && len(n.leaves) == 0 && len(n.deep) == 0
+}
+
+// insertHandler returns a copy of list in which h is inserted after every handler which is not less specific than h,
+// so that handlers of equal precedence keep their registration order. The list is not modified, it may be shared.
+func insertHandler(list []*Handler, h *Handler) []*Handler {
+	i := len(list)
+	for i > 0 && h.precedes(list[i-1]) {
+		i--
+	}
+	list = append(list[:len(list):len(list)], nil)
+	copy(list[i+1:], list[i:])
+	list[i] = h
+	return list
+}
+
+// lookup calls fn for each handler which may match the components, from the most specific to the least.
+// The handlers still have to be verified by Pattern.Match. lookup stops as soon as fn returns true.
+//
+// The traversal order is the one defined by Pattern.precedes: at every depth
+// literals are tried before mixed segments, mixed segments before wildcards, and wildcards before deep wildcards.
+func (n *node) lookup(components []string, fn func(*Handler) bool) bool {
+	if len(components) == 0 {
+		for _, h := range n.leaves {
+			if fn(h) {
+				return true
+			}
+		}
+	} else {
+		if child, ok := n.static[components[0]]; ok && child.lookup(components[1:], fn) {
+			return true
+		}
+		for _, m := range n.mixed {
+			if m.lookup(components[1:], fn) {
+				return true
+			}
+		}
+		if n.wildcard != nil && n.wildcard.lookup(components[1:], fn) {
+			return true
+		}
+	}
+	for _, h := range n.deep {
+		if fn(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// fold calls fn with the components rewritten to the literals of the tree,
+// for each route of the tree which equals to the components when the literals are compared case-insensitively.
+// The slice passed to fn is only valid during the call. fold stops as soon as fn returns true.
+func (n *node) fold(components []string, fixed []string, fn func([]string) bool) bool {
+	if len(components) == 0 {
+		if len(n.leaves) > 0 && fn(fixed) {
+			return true
+		}
+	} else {
+		c := components[0]
+		if child, ok := n.static[c]; ok && child.fold(components[1:], append(fixed, c), fn) {
+			return true
+		}
+		for lit, child := range n.static {
+			if lit != c && strings.EqualFold(lit, c) && child.fold(components[1:], append(fixed, lit), fn) {
+				return true
+			}
+		}
+		for _, m := range n.mixed {
+			if m.fold(components[1:], append(fixed, c), fn) {
+				return true
+			}
+		}
+		if n.wildcard != nil && n.wildcard.fold(components[1:], append(fixed, c), fn) {
+			return true
+		}
+	}
+	return len(n.deep) > 0 && fn(append(fixed, components...))
+}
+
+// walk calls fn for each handler of the tree in the order of lookup.
+// The children of a node are walked in the order of their literals. walk stops as soon as fn returns an error.
+func (n *node) walk(fn func(*Handler) error) error {
+	for _, h := range n.leaves {
+		if err := fn(h); err != nil {
+			return err
+		}
+	}
+	lits := make([]string, 0, len(n.static))
+	for lit := range n.static {
+		lits = append(lits, lit)
+	}
+	sort.Strings(lits)
+	for _, lit := range lits {
+		if err := n.static[lit].walk(fn); err != nil {
+			return err
+		}
+	}
+	for _, m := range n.mixed {
+		if err := m.walk(fn); err != nil {
+			return err
+		}
+	}
+	if n.wildcard != nil {
+		if err := n.wildcard.walk(fn); err != nil {
+			return err
+		}
+	}
+	for _, h := range n.deep {
+		if err := fn(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package ctxrouter
+
+import (
+	"errors"
+	"fmt"
+)
+
+//snapshot the routes of router, it is never modified after it is stored in Router.state
+type snapshot struct {
+	//routes the routes without host template
+	routes *table
+	//hosts the routes of host templates, most specific first
+	hosts []*hostTable
+	//names the named routes, see WithName
+	names map[string]*Handler
+	//gen the update which the snapshot belongs to, see table.gen
+	gen uint64
+}
+
+func newSnapshot() *snapshot {
+	return &snapshot{
+		routes: newTable(0),
+		names:  make(map[string]*Handler),
+	}
+}
+
+//clone returns a copy of snapshot which can be modified by the update of gen, the handlers and trees are shared
+func (s *snapshot) clone(gen uint64) *snapshot {
+	c := &snapshot{
+		routes: s.routes.clone(gen),
+		hosts:  make([]*hostTable, len(s.hosts)),
+		names:  make(map[string]*Handler, len(s.names)),
+		gen:    gen,
+	}
+	for i, ht := range s.hosts {
+		c.hosts[i] = &hostTable{table: ht.table.clone(gen), template: ht.template, pat: ht.pat}
+	}
+	for name, h := range s.names {
+		c.names[name] = h
+	}
+	return c
+}
+
+//load returns the current routes of router
+func (s *Router) load() *snapshot {
+	if snap := s.state.Load(); snap != nil {
+		return snap
+	}
+	return newSnapshot()
+}
+
+//Tx a batch of route changes, see Router.Update
+type Tx struct {
+	router *Router
+	snap   *snapshot
+}
+
+//Update calls fn with a copy of the routes, and replaces the routes of router with it if fn returns nil.
+//The requests being served keep using the routes before the update, so routes can be added, replaced
+//and removed at any time without locking the requests. The updates are serialized,
+//and none of the changes of fn are applied if it returns an error.
+//
+//	err := r.Update(func(tx *ctxrouter.Tx) error {
+//		if err := tx.Remove("GET", "/v1/plugins/old"); err != nil {
+//			return err
+//		}
+//		return tx.Handle("GET", "/v1/plugins/new", handler)
+//	})
+func (s *Router) Update(fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	tx := &Tx{router: s, snap: s.load().clone(s.gen)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.state.Store(tx.snap)
+	return nil
+}
+
+//Replace registers the route in place of the routes of the same method and template, see Tx.Replace
+func (s *Router) Replace(method, path string, v interface{}, opts ...RouteOption) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.Replace(method, path, v, opts...)
+	})
+}
+
+//Remove removes the routes of the method and template, see Tx.Remove
+func (s *Router) Remove(method, path string, opts ...RouteOption) error {
+	return s.Update(func(tx *Tx) error {
+		return tx.Remove(method, path, opts...)
+	})
+}
+
+//Handle is Router.Handle in the transaction
+func (tx *Tx) Handle(method, path string, v interface{}, opts ...RouteOption) error {
+	h, err := newHandler(path, v, opts, &tx.router.paramTypes)
+	if err != nil {
+		return err
+	}
+	if method == "" {
+		method = "*"
+	}
+	if h.Name != "" {
+		if _, ok := tx.snap.names[h.Name]; ok {
+			return errors.New("duplicate route name: " + h.Name)
+		}
+	}
+	t := tx.snap.routes
+	if h.host != "" {
+		if t, err = tx.snap.hostTable(h.host); err != nil {
+			return err
+		}
+	}
+	if err = t.conflict(method, h, tx.router.Strict); err != nil {
+		return err
+	}
+	t.insert(method, h)
+	if h.Name != "" {
+		tx.snap.names[h.Name] = h
+	}
+	return nil
+}
+
+//Replace registers the route in place of the routes of the same method, host and template if there are any,
+//see Remove for the routes which are replaced
+func (tx *Tx) Replace(method, path string, v interface{}, opts ...RouteOption) error {
+	if _, err := tx.remove(method, path, opts); err != nil {
+		return err
+	}
+	return tx.Handle(method, path, v, opts...)
+}
+
+//Remove removes the routes of the method and template, including the routes with matchers.
+//The templates are compared after parsing, so /users/:id removes /users/{id}, but not /users/{name} or /users/{id:int}.
+//The routes of a host template are removed when WithHost is in opts, the other options are ignored.
+//It returns an error if there is no such route
+func (tx *Tx) Remove(method, path string, opts ...RouteOption) error {
+	n, err := tx.remove(method, path, opts)
+	if err == nil && n == 0 {
+		err = fmt.Errorf("route not found: %s %s", method, path)
+	}
+	return err
+}
+
+//remove removes the routes of the method and template, and returns the number of removed routes
+func (tx *Tx) remove(method, path string, opts []RouteOption) (int, error) {
+	pattern, constraints, err := parseTemplate(path)
+	if err != nil {
+		return 0, err
+	}
+	h := Handler{Pat: pattern, constraints: constraints}
+	for _, opt := range opts {
+		opt(&h)
+	}
+	if method == "" {
+		method = "*"
+	}
+	t := tx.snap.routes
+	if h.host != "" {
+		t = nil
+		for _, ht := range tx.snap.hosts {
+			if hostPath(ht.template) == hostPath(h.host) {
+				t = ht.table
+			}
+		}
+		if t == nil {
+			return 0, nil
+		}
+	}
+	removed := t.remove(method, &h)
+	for _, r := range removed {
+		if r.Name != "" {
+			delete(tx.snap.names, r.Name)
+		}
+	}
+	if h.host != "" && len(t.trees) == 0 {
+		//the host tables without routes are dropped, so that they are not matched any more
+		for i, ht := range tx.snap.hosts {
+			if ht.table == t {
+				tx.snap.hosts = append(tx.snap.hosts[:i], tx.snap.hosts[i+1:]...)
+				break
+			}
+		}
+	}
+	return len(removed), nil
+}
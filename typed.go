@@ -0,0 +1,76 @@
+package ctxrouter
+
+import (
+	"net/http"
+	"reflect"
+)
+
+//Registrar registers the routes, it is implemented by Router, Group and Tx
+type Registrar interface {
+	Handle(method, path string, v interface{}, opts ...RouteOption) error
+}
+
+//Handle registers the typed handler of method and path by r, the signature of handler is checked at compile time.
+//The context is a pointer to any context type, it is initialized and decodes the request as the contexts of context handlers,
+//then the body, the query and the path variables are decoded into the request struct in order, see Request Structs,
+//the response and error are encoded like the results of context handlers. exp:
+//
+//	ctxrouter.Handle(r, "GET", "/v1/{name=shelves/*}", func(ctx *ctxrouter.Context, req *GetShelfRequest) (*Shelf, error) {
+//		return store.GetShelf(req.Name)
+//	})
+func Handle[C any, PC interface {
+	*C
+	ContextInterface
+}, Req, Resp any](r Registrar, method, path string, handler func(ctx PC, req *Req) (*Resp, error), opts ...RouteOption) error {
+	return r.Handle(method, path, typedFunc[C, PC, Req, Resp](handler), opts...)
+}
+
+//typedHandler the handler registered by Handle, it is called without reflection
+type typedHandler interface {
+	//contextType returns the context type
+	contextType() reflect.Type
+	//requestType returns the pointer type of request struct
+	requestType() reflect.Type
+	serve(r *Router, w http.ResponseWriter, req *http.Request, h *Handler, ps *PathParams)
+}
+
+type typedFunc[C any, PC interface {
+	*C
+	ContextInterface
+}, Req, Resp any] func(ctx PC, req *Req) (*Resp, error)
+
+func (fn typedFunc[C, PC, Req, Resp]) contextType() reflect.Type {
+	return reflect.TypeOf((*C)(nil)).Elem()
+}
+
+func (fn typedFunc[C, PC, Req, Resp]) requestType() reflect.Type {
+	return reflect.TypeOf((*Req)(nil))
+}
+
+func (fn typedFunc[C, PC, Req, Resp]) serve(r *Router, w http.ResponseWriter, req *http.Request, h *Handler, ps *PathParams) {
+	ctx := PC(new(C))
+	ctx.Init(w, req)
+	if err := ctx.DecodeRequest(); err != nil {
+		r.decodeFailed(w, req, err)
+		return
+	}
+	in := new(Req)
+	if err := h.decodeBody(bodyDecoder(ctx, req), reflect.ValueOf(in).Elem()); err != nil {
+		r.decodeFailed(w, req, err)
+		return
+	}
+	if err := h.request.decode(req, reflect.ValueOf(in).Elem(), ps, r.DisallowUnknownQuery); err != nil {
+		r.decodeFailed(w, req, err)
+		return
+	}
+	resp, err := fn(ctx, in)
+	var data interface{}
+	if resp != nil {
+		data = resp
+	}
+	var statusError Error
+	if err != nil {
+		statusError = errorFromValue(reflect.ValueOf(&err).Elem())
+	}
+	respond(w, data, resp != nil, statusError)
+}
@@ -27,6 +27,10 @@ type variable struct {
 	segments []segment
 }
 
+// mixed is a path segment of literals and single segment variables, exp: {name}.{ext}, v{version}, @{user}.
+// Two variables are never adjacent, so each variable but the last one ends at the first occurrence of the literal after it.
+type mixed []segment
+
 func (wildcard) String() string {
 	return "*"
 }
@@ -47,6 +51,14 @@ func (v variable) String() string {
 	return fmt.Sprintf("{%s=%s}", v.path, strings.Join(segs, "/"))
 }
 
+func (m mixed) String() string {
+	var parts []string
+	for _, s := range m {
+		parts = append(parts, s.String())
+	}
+	return strings.Join(parts, "")
+}
+
 func (t template) String() string {
 	var segs []string
 	for _, s := range t.segments {
@@ -77,6 +77,20 @@ func TestTemplateStringer(t *testing.T) {
 			},
 			want: "/v1/{name=a/*/b}/c/{field.nested=*/d}/*/e/**",
 		},
+		{
+			segs: []segment{
+				mixed{
+					literal("v"),
+					variable{path: "version", segments: []segment{wildcard{}}},
+				},
+				mixed{
+					variable{path: "name", segments: []segment{wildcard{}}},
+					literal("."),
+					variable{path: "ext", segments: []segment{wildcard{}}},
+				},
+			},
+			want: "/v{version=*}/{name=*}.{ext=*}",
+		},
 	} {
 		tmpl := template{segments: spec.segs}
 		if got, want := tmpl.String(), spec.want; got != want {
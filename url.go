@@ -0,0 +1,43 @@
+package ctxrouter
+
+import (
+	"errors"
+	"net/url"
+)
+
+//URL build the escaped path of the named route by the key value pairs of its variables,
+//exp: r.URL("book", "shelf", "1", "book", "2") , it returns an error if any variable is missing or unknown
+func (s *Router) URL(name string, pairs ...string) (string, error) {
+	return s.URLQuery(name, nil, pairs...)
+}
+
+//URLQuery is URL with the query string appended
+func (s *Router) URLQuery(name string, query url.Values, pairs ...string) (string, error) {
+	h, ok := s.load().names[name]
+	if !ok {
+		return "", errors.New("route not found: " + name)
+	}
+	if len(pairs)%2 != 0 {
+		return "", errors.New("the variables of route must be key value pairs")
+	}
+	params := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		if !contains(h.Pat.vars, pairs[i]) {
+			return "", errors.New("unknown variable " + pairs[i] + " of route " + name)
+		}
+		params[pairs[i]] = pairs[i+1]
+	}
+	for field, c := range h.constraints {
+		if v, ok := params[field]; ok && !c.match(v) {
+			return "", errors.New("variable " + field + " of route " + name + " does not satisfy " + c.expr)
+		}
+	}
+	p, err := h.Pat.build(params)
+	if err != nil {
+		return "", err
+	}
+	if len(query) > 0 {
+		p += "?" + query.Encode()
+	}
+	return p, nil
+}